@@ -0,0 +1,67 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// defaultAnalysisPollInterval is the interval used by WaitForAnalysis when
+// none is specified.
+const defaultAnalysisPollInterval = 15 * time.Second
+
+// WaitForAnalysis polls the analysis with the given ID, as returned by the
+// file and URL scanners, until its status is "completed" or the context is
+// cancelled. It returns the completed analysis object. The analysis is
+// requested every interval, or every 15 seconds if interval is zero. The
+// requests are subject to the client's rate limit, if any. An error is
+// returned right away if the analysis can't be retrieved, for example because
+// the ID is unknown.
+func (cli *Client) WaitForAnalysis(ctx context.Context, id string, interval time.Duration) (*Object, error) {
+	if interval <= 0 {
+		interval = defaultAnalysisPollInterval
+	}
+	return cli.pollObject(ctx, cli.scanURL("analyses/%s", id), interval,
+		func(obj *Object) (bool, error) {
+			status, _ := obj.GetAttributeString("status")
+			return status == "completed", nil
+		})
+}
+
+// pollObject requests the object at the given URL every interval until done
+// returns true or an error, or the context is cancelled, and returns the
+// object for which done returned true. An error is returned right away if the
+// object can't be retrieved.
+func (cli *Client) pollObject(ctx context.Context, u *url.URL, interval time.Duration, done func(*Object) (bool, error)) (*Object, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		obj, err := cli.GetObjectWithContext(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		if ok, err := done(obj); err != nil {
+			return nil, err
+		} else if ok {
+			return obj, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package vt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWaitForAnalysis(t *testing.T) {
+	polls := 0
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/analyses/foo" {
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		polls++
+		status := "queued"
+		if polls == 3 {
+			status = "completed"
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"type": "analysis", "id": "foo",
+				"attributes": map[string]interface{}{"status": status}}})
+	})
+
+	obj, err := cli.WaitForAnalysis(context.Background(), "foo", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := obj.GetAttributeString("status"); status != "completed" || polls != 3 {
+		t.Errorf("got status %q after %d polls", status, polls)
+	}
+
+	if _, err := cli.WaitForAnalysis(context.Background(), "bar", time.Millisecond); err == nil {
+		t.Error("expecting error for unknown analysis")
+	}
+
+	polls = -100
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := cli.WaitForAnalysis(ctx, "foo", time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, expecting %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Reputation returns the object's community reputation score, as found in
+// the "reputation" attribute of files, URLs, domains and IP addresses. The
+// boolean is false if the object doesn't have a reputation.
+func (obj *Object) Reputation() (int, bool) {
+	r, err := obj.GetAttributeInt64("reputation")
+	if err != nil {
+		return 0, false
+	}
+	return int(r), true
+}
+
+// ThreatSeverity returns the object's threat severity level (i.e:
+// "SEVERITY_LOW", "SEVERITY_HIGH"), as found in the "threat_severity"
+// attribute of files, URLs, domains and IP addresses. The boolean is false if
+// the object doesn't have a threat severity.
+func (obj *Object) ThreatSeverity() (string, bool) {
+	ts, ok := obj.Attributes["threat_severity"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	level, ok := ts["threat_severity_level"].(string)
+	return level, ok
+}
+
+// LastModified returns the time at which the object was last modified, as
+// found in the "last_modification_date" attribute.
+func (obj *Object) LastModified() (time.Time, error) {
+	return obj.GetAttributeTime("last_modification_date")
+}
+
+// Age returns the time elapsed since the object was last analysed, as found in
+// the "last_analysis_date" attribute, or since it was last submitted if it
+// doesn't have that attribute. This is useful for deciding whether a file
+// must be analysed again with Client.Rescan. It returns an error if the object
+// doesn't have any of the attributes.
+func (obj *Object) Age() (time.Duration, error) {
+	t, err := obj.GetAttributeTime("last_analysis_date")
+	if err != nil {
+		if t, err = obj.GetAttributeTime("last_submission_date"); err != nil {
+			return 0, err
+		}
+	}
+	return time.Since(t), nil
+}
+
+// AnalysisStats contains the number of engines that reported each verdict in
+// the last analysis of a file, URL, domain or IP address, as found in the
+// "last_analysis_stats" attribute.
+type AnalysisStats struct {
+	Harmless   int `json:"harmless"`
+	Malicious  int `json:"malicious"`
+	Suspicious int `json:"suspicious"`
+	Undetected int `json:"undetected"`
+	Timeout    int `json:"timeout"`
+}
+
+// Total returns the number of engines that reported a verdict, which doesn't
+// include those that timed out.
+func (s AnalysisStats) Total() int {
+	return s.Harmless + s.Malicious + s.Suspicious + s.Undetected
+}
+
+// DetectionRatio returns the fraction of the engines that reported a verdict
+// which flagged the object as malicious, between 0 and 1. It's zero if no
+// engine reported a verdict.
+func (s AnalysisStats) DetectionRatio() float64 {
+	total := s.Total()
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Malicious) / float64(total)
+}
+
+// AnalysisStats returns the statistics of the object's last analysis, as
+// found in the "last_analysis_stats" attribute. It returns an error if the
+// object doesn't have the attribute.
+func (obj *Object) AnalysisStats() (AnalysisStats, error) {
+	var stats AnalysisStats
+	v, err := obj.Get("last_analysis_stats")
+	if err != nil {
+		return stats, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return stats, fmt.Errorf("attribute \"last_analysis_stats\" is not a map")
+	}
+	err = unmarshalMap(m, &stats)
+	return stats, err
+}
+
+// MaliciousCount returns the number of engines that flagged the object as
+// malicious in its last analysis, see AnalysisStats.
+func (obj *Object) MaliciousCount() (int, error) {
+	stats, err := obj.AnalysisStats()
+	return stats.Malicious, err
+}
+
+// DetectionRatio returns the fraction of engines that flagged the object as
+// malicious in its last analysis, see AnalysisStats.DetectionRatio.
+func (obj *Object) DetectionRatio() (float64, error) {
+	stats, err := obj.AnalysisStats()
+	if err != nil {
+		return 0, err
+	}
+	return stats.DetectionRatio(), nil
+}
+
+// EngineResult is the result of a single engine in the last analysis of a
+// file or URL, as found in the "last_analysis_results" attribute.
+type EngineResult struct {
+	// Category is the verdict of the engine, like "malicious", "suspicious",
+	// "undetected" or "harmless".
+	Category   string `json:"category"`
+	EngineName string `json:"engine_name"`
+	// EngineVersion and EngineUpdate are the version of the engine and the
+	// date of its signatures (i.e: "20210630").
+	EngineVersion string `json:"engine_version"`
+	EngineUpdate  string `json:"engine_update"`
+	// Result is the name of the detection, like "EICAR-Test-File", it's empty
+	// if the engine didn't detect anything.
+	Result string `json:"result"`
+	Method string `json:"method"`
+}
+
+// AnalysisResults returns the result of each engine in the object's last
+// analysis, keyed by engine name, as found in the "last_analysis_results"
+// attribute. It returns an error if the object doesn't have the attribute,
+// like a file that is still being analysed for the first time.
+func (obj *Object) AnalysisResults() (map[string]EngineResult, error) {
+	v, err := obj.Get("last_analysis_results")
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("attribute \"last_analysis_results\" is not a map")
+	}
+	var results map[string]EngineResult
+	if err := unmarshalMap(m, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// DetectedBy returns the names of the engines that flagged the object as
+// malicious or suspicious in its last analysis, in alphabetical order. It
+// returns nil if there are no such engines, including when the object doesn't
+// have analysis results, use AnalysisResults for telling apart both cases.
+func (obj *Object) DetectedBy() []string {
+	results, err := obj.AnalysisResults()
+	if err != nil {
+		return nil
+	}
+	var engines []string
+	for name, r := range results {
+		if r.Category == "malicious" || r.Category == "suspicious" {
+			engines = append(engines, name)
+		}
+	}
+	sort.Strings(engines)
+	return engines
+}
@@ -0,0 +1,152 @@
+package vt
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReputationAndThreatSeverity(t *testing.T) {
+	obj := &Object{}
+	err := json.Unmarshal([]byte(`{
+	  "type": "domain",
+	  "id": "evil.com",
+	  "attributes": {
+	    "reputation": -23,
+	    "threat_severity": {
+	      "version": 1,
+	      "threat_severity_level": "SEVERITY_HIGH",
+	      "level_description": "Severity HIGH because it was considered malicious"
+	    }
+	  }
+	}`), obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := obj.Reputation(); !ok || r != -23 {
+		t.Errorf("Reputation() = %d, %v; expecting -23, true", r, ok)
+	}
+	if s, ok := obj.ThreatSeverity(); !ok || s != "SEVERITY_HIGH" {
+		t.Errorf("ThreatSeverity() = %q, %v; expecting \"SEVERITY_HIGH\", true", s, ok)
+	}
+
+	obj = NewObject()
+	if _, ok := obj.Reputation(); ok {
+		t.Error("Reputation() returned true for object without reputation")
+	}
+	if _, ok := obj.ThreatSeverity(); ok {
+		t.Error("ThreatSeverity() returned true for object without threat severity")
+	}
+}
+
+func TestLastModifiedAndAge(t *testing.T) {
+	now := time.Now()
+	obj := NewObject()
+	obj.Attributes["last_modification_date"] = now.Add(-time.Hour).Unix()
+	obj.Attributes["last_submission_date"] = now.Add(-2 * time.Hour).Unix()
+	if m, err := obj.LastModified(); err != nil || m.Unix() != now.Add(-time.Hour).Unix() {
+		t.Errorf("LastModified() = %v, %v", m, err)
+	}
+	if age, err := obj.Age(); err != nil || age < 2*time.Hour-time.Second || age > 2*time.Hour+time.Second {
+		t.Errorf("Age() = %v, %v; expecting 2h", age, err)
+	}
+	obj.Attributes["last_analysis_date"] = now.Add(-3 * time.Hour).Unix()
+	if age, err := obj.Age(); err != nil || age < 3*time.Hour-time.Second || age > 3*time.Hour+time.Second {
+		t.Errorf("Age() = %v, %v; expecting 3h", age, err)
+	}
+
+	obj = NewObject()
+	if _, err := obj.LastModified(); err == nil {
+		t.Error("LastModified() didn't fail for object without modification date")
+	}
+	if _, err := obj.Age(); err == nil {
+		t.Error("Age() didn't fail for object without analysis date")
+	}
+}
+
+func TestAnalysisStats(t *testing.T) {
+	obj := &Object{}
+	err := json.Unmarshal([]byte(`{
+	  "type": "file",
+	  "id": "foo",
+	  "attributes": {
+	    "last_analysis_stats": {
+	      "harmless": 0,
+	      "malicious": 15,
+	      "suspicious": 1,
+	      "undetected": 44,
+	      "timeout": 2,
+	      "type-unsupported": 4
+	    }
+	  }
+	}`), obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := obj.AnalysisStats()
+	expected := AnalysisStats{Malicious: 15, Suspicious: 1, Undetected: 44, Timeout: 2}
+	if err != nil || stats != expected {
+		t.Errorf("AnalysisStats() = %+v, %v; expecting %+v", stats, err, expected)
+	}
+	if m, err := obj.MaliciousCount(); err != nil || m != 15 {
+		t.Errorf("MaliciousCount() = %d, %v; expecting 15", m, err)
+	}
+	if r, err := obj.DetectionRatio(); err != nil || r != 0.25 {
+		t.Errorf("DetectionRatio() = %v, %v; expecting 0.25", r, err)
+	}
+
+	// No engine reported a verdict.
+	if r := (AnalysisStats{Timeout: 3}).DetectionRatio(); r != 0 {
+		t.Errorf("DetectionRatio() = %v for stats without verdicts", r)
+	}
+
+	obj = NewObject()
+	if _, err := obj.AnalysisStats(); err == nil {
+		t.Error("AnalysisStats() didn't fail for object without stats")
+	}
+	if _, err := obj.MaliciousCount(); err == nil {
+		t.Error("MaliciousCount() didn't fail for object without stats")
+	}
+	if _, err := obj.DetectionRatio(); err == nil {
+		t.Error("DetectionRatio() didn't fail for object without stats")
+	}
+	obj.Attributes["last_analysis_stats"] = "invalid"
+	if _, err := obj.AnalysisStats(); err == nil {
+		t.Error("AnalysisStats() didn't fail for invalid stats")
+	}
+}
+
+func TestAnalysisResults(t *testing.T) {
+	obj := loadObject(t, "file.json")
+	results, err := obj.AnalysisResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := EngineResult{
+		Category:      "malicious",
+		EngineName:    "Kaspersky",
+		EngineVersion: "21.0.1.45",
+		EngineUpdate:  "20210629",
+		Result:        "EICAR-Test-File",
+		Method:        "blacklist",
+	}
+	if len(results) != 3 || results["Kaspersky"] != expected {
+		t.Errorf("got results %+v", results)
+	}
+	if r := results["Acronis"]; r.Category != "undetected" || r.Result != "" {
+		t.Errorf("got result %+v for Acronis", r)
+	}
+	if engines := obj.DetectedBy(); !reflect.DeepEqual(engines, []string{"ESET-NOD32", "Kaspersky"}) {
+		t.Errorf("got engines %v", engines)
+	}
+
+	obj = NewObject()
+	if _, err := obj.AnalysisResults(); err == nil || !strings.Contains(err.Error(), "last_analysis_results") {
+		t.Errorf("got error %v for object without results", err)
+	}
+	if engines := obj.DetectedBy(); engines != nil {
+		t.Errorf("got engines %v for object without results", engines)
+	}
+}
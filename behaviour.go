@@ -0,0 +1,97 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import (
+	"fmt"
+)
+
+// getAttributeList returns an attribute that must be a list. If the attribute
+// doesn't exist the result is nil, without error.
+func (obj *Object) getAttributeList(name string) ([]interface{}, error) {
+	attrValue, attrExists := obj.Attributes[name]
+	if !attrExists || attrValue == nil {
+		return nil, nil
+	}
+	l, isList := attrValue.([]interface{})
+	if !isList {
+		return nil, fmt.Errorf("attribute \"%s\" is not a list", name)
+	}
+	return l, nil
+}
+
+// BehaviourVerdicts returns the verdicts (i.e: "MALWARE", "RANSOM", "CLEAN")
+// included in a behaviour report, which is an object of type "file_behaviour".
+// If the report doesn't have verdicts the result is empty.
+func (obj *Object) BehaviourVerdicts() ([]string, error) {
+	l, err := obj.getAttributeList("verdicts")
+	if err != nil {
+		return nil, err
+	}
+	verdicts := make([]string, 0, len(l))
+	for _, v := range l {
+		s, isString := v.(string)
+		if !isString {
+			return nil, fmt.Errorf("attribute \"verdicts\" contains a non-string value")
+		}
+		verdicts = append(verdicts, s)
+	}
+	return verdicts, nil
+}
+
+// MitreTechniques returns the IDs of the MITRE ATT&CK techniques (i.e: "T1055")
+// observed in a behaviour report, which is an object of type "file_behaviour".
+// Each technique appears only once in the result, even if it was observed
+// multiple times. If the report doesn't have MITRE techniques the result is
+// empty.
+func (obj *Object) MitreTechniques() ([]string, error) {
+	l, err := obj.getAttributeList("mitre_attack_techniques")
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	techniques := make([]string, 0, len(l))
+	for _, v := range l {
+		t, isMap := v.(map[string]interface{})
+		if !isMap {
+			return nil, fmt.Errorf("attribute \"mitre_attack_techniques\" contains a non-object value")
+		}
+		id, isString := t["id"].(string)
+		if !isString {
+			return nil, fmt.Errorf("attribute \"mitre_attack_techniques\" contains a technique without ID")
+		}
+		if !seen[id] {
+			seen[id] = true
+			techniques = append(techniques, id)
+		}
+	}
+	return techniques, nil
+}
+
+// SandboxName returns the name of the sandbox that produced a behaviour report,
+// which is an object of type "file_behaviour".
+func (obj *Object) SandboxName() (string, error) {
+	return obj.GetAttributeString("sandbox_name")
+}
+
+// FileSandboxReports returns the behaviour reports for the file with the given
+// hash (SHA-256, SHA-1 or MD5). There's one report per sandbox that analysed
+// the file, use SandboxName for knowing which sandbox produced each of them.
+func (cli *Client) FileSandboxReports(hash string) ([]*Object, error) {
+	it, err := cli.Iterator(URL("files/%s/behaviours", hash))
+	if err != nil {
+		return nil, err
+	}
+	return it.Collect()
+}
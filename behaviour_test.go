@@ -0,0 +1,92 @@
+package vt
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+const behaviourReport = `{
+  "type": "file_behaviour",
+  "id": "5353e23f3653402339c93a8565307c6308ff378e03fcf23a4378f31c434030b0_VirusTotal Jujubox",
+  "attributes": {
+    "sandbox_name": "VirusTotal Jujubox",
+    "verdicts": ["MALWARE", "RANSOM"],
+    "tags": ["DETECT_DEBUG_ENVIRONMENT", "DIRECT_CPU_CLOCK_ACCESS"],
+    "mitre_attack_techniques": [
+      {"id": "T1497", "signature_description": "May try to detect the virtual machine", "severity": "IMPACT_SEVERITY_INFO"},
+      {"id": "T1055", "signature_description": "Injects a PE file into a foreign process", "severity": "IMPACT_SEVERITY_HIGH"},
+      {"id": "T1497", "signature_description": "Contains long sleeps", "severity": "IMPACT_SEVERITY_INFO"}
+    ]
+  }
+}`
+
+func TestBehaviourVerdictsAndMitreTechniques(t *testing.T) {
+	obj := &Object{}
+	if err := json.Unmarshal([]byte(behaviourReport), obj); err != nil {
+		t.Fatal(err)
+	}
+	verdicts, err := obj.BehaviourVerdicts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(verdicts, []string{"MALWARE", "RANSOM"}) {
+		t.Errorf("unexpected verdicts: %v", verdicts)
+	}
+	techniques, err := obj.MitreTechniques()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(techniques, []string{"T1497", "T1055"}) {
+		t.Errorf("unexpected techniques: %v", techniques)
+	}
+}
+
+func TestBehaviourVerdictsAndMitreTechniquesAbsent(t *testing.T) {
+	obj := NewObject()
+	obj.Type = "file_behaviour"
+	if verdicts, err := obj.BehaviourVerdicts(); err != nil || len(verdicts) != 0 {
+		t.Errorf("got %v, %v for a report without verdicts", verdicts, err)
+	}
+	if techniques, err := obj.MitreTechniques(); err != nil || len(techniques) != 0 {
+		t.Errorf("got %v, %v for a report without techniques", techniques, err)
+	}
+	obj.Attributes["verdicts"] = "MALWARE"
+	if _, err := obj.BehaviourVerdicts(); err == nil {
+		t.Error("expecting error for verdicts that are not a list")
+	}
+}
+
+func TestFileSandboxReports(t *testing.T) {
+	const hash = "5353e23f3653402339c93a8565307c6308ff378e03fcf23a4378f31c434030b0"
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/files/"+hash+"/behaviours" {
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": []map[string]interface{}{
+				{"type": "file_behaviour", "id": hash + "_Zenbox",
+					"attributes": map[string]interface{}{"sandbox_name": "Zenbox"}},
+				{"type": "file_behaviour", "id": hash + "_VirusTotal Jujubox",
+					"attributes": map[string]interface{}{"sandbox_name": "VirusTotal Jujubox"}},
+			},
+		})
+	})
+	reports, err := cli.FileSandboxReports(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range reports {
+		name, err := r.SandboxName()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if !reflect.DeepEqual(names, []string{"Zenbox", "VirusTotal Jujubox"}) {
+		t.Errorf("unexpected sandbox names: %v", names)
+	}
+}
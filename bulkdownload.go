@@ -0,0 +1,239 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bulkRetryBackoff is the time waited before retrying a failed download for
+// the first time, it's doubled for every subsequent retry.
+var bulkRetryBackoff = time.Second
+
+// BulkDownloader downloads many files concurrently into a directory, where
+// each file is stored at a path derived from its hash, like ab/cd/abcd... for
+// the file with hash abcd.... Files that already exist in the directory are
+// not downloaded again, which allows resuming an interrupted download by
+// running it again with the same hashes. BulkDownloader is created with
+// Client.NewBulkDownloader.
+type BulkDownloader struct {
+	client     *Client
+	dir        string
+	workers    int
+	maxRetries int
+	progress   func(done, total int)
+	result     func(DownloadResult)
+}
+
+// DownloadResult is the outcome of downloading a single file with a
+// BulkDownloader.
+type DownloadResult struct {
+	Hash string
+	// Path is the path where the file is stored, it's empty if the hash is
+	// not valid.
+	Path string
+	// Skipped is true if the file was not downloaded because it already
+	// existed.
+	Skipped bool
+	// Err is the error that caused the download to fail, if any.
+	Err error
+}
+
+// BulkDownloadSummary contains the number of files downloaded, skipped and
+// failed by BulkDownloader.Download, and the error for each failed file.
+type BulkDownloadSummary struct {
+	Downloaded int
+	Skipped    int
+	Failed     int
+	// Errors contains the error for each of the files that couldn't be
+	// downloaded, keyed by hash.
+	Errors map[string]error
+}
+
+// BulkDownloadOption represents an option passed to Client.NewBulkDownloader.
+type BulkDownloadOption func(*BulkDownloader)
+
+// WithDownloadWorkers specifies the maximum number of files downloaded
+// concurrently. The default is 10. Downloads are subject to the client's rate
+// limit, if any, regardless of the number of workers.
+func WithDownloadWorkers(n int) BulkDownloadOption {
+	return func(d *BulkDownloader) {
+		d.workers = n
+	}
+}
+
+// WithDownloadRetries specifies the maximum number of times that a download
+// is retried after failing with a transient error, like a timeout or a quota
+// error. The default is 3.
+func WithDownloadRetries(n int) BulkDownloadOption {
+	return func(d *BulkDownloader) {
+		d.maxRetries = n
+	}
+}
+
+// WithDownloadProgress specifies a function that is called every time a file
+// is downloaded, skipped or fails, with the number of files processed so far
+// and the total number of files. Calls are never concurrent.
+func WithDownloadProgress(fn func(done, total int)) BulkDownloadOption {
+	return func(d *BulkDownloader) {
+		d.progress = fn
+	}
+}
+
+// WithDownloadResults specifies a function that is called with the result of
+// every file, after it's downloaded, skipped or fails. Calls are never
+// concurrent.
+func WithDownloadResults(fn func(DownloadResult)) BulkDownloadOption {
+	return func(d *BulkDownloader) {
+		d.result = fn
+	}
+}
+
+// NewBulkDownloader returns a BulkDownloader that stores the downloaded files
+// in the given directory, which is created if it doesn't exist.
+func (cli *Client) NewBulkDownloader(dir string, options ...BulkDownloadOption) *BulkDownloader {
+	d := &BulkDownloader{
+		client:     cli,
+		dir:        dir,
+		workers:    10,
+		maxRetries: 3,
+	}
+	for _, opt := range options {
+		opt(d)
+	}
+	if d.workers <= 0 {
+		d.workers = 1
+	}
+	return d
+}
+
+// Path returns the path where the file with the given hash is stored, or an
+// error if the hash is not a valid MD5, SHA-1 or SHA-256. The first two pairs
+// of characters in the hash are used as subdirectories, so that directories
+// don't end up with too many files.
+func (d *BulkDownloader) Path(hash string) (string, error) {
+	if n := len(hash); n != 32 && n != 40 && n != 64 {
+		return "", fmt.Errorf("invalid hash %q", hash)
+	}
+	for _, c := range hash {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return "", fmt.Errorf("invalid hash %q", hash)
+		}
+	}
+	hash = strings.ToLower(hash)
+	return filepath.Join(d.dir, hash[0:2], hash[2:4], hash), nil
+}
+
+// Download downloads the files with the given hashes, and returns a summary
+// of the files downloaded, skipped and failed. A failed file doesn't stop the
+// download of the remaining ones. If the context is cancelled no more files
+// are downloaded, the downloads in progress are aborted, and the summary of
+// the files processed until then is returned together with the context's
+// error.
+func (d *BulkDownloader) Download(ctx context.Context, hashes []string) (*BulkDownloadSummary, error) {
+	summary := &BulkDownloadSummary{Errors: make(map[string]error)}
+	// mu serializes the updates to the summary and the calls to the
+	// callbacks.
+	var mu sync.Mutex
+	done := 0
+	report := func(r DownloadResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Err != nil:
+			summary.Failed++
+			summary.Errors[r.Hash] = r.Err
+		case r.Skipped:
+			summary.Skipped++
+		default:
+			summary.Downloaded++
+		}
+		done++
+		if d.result != nil {
+			d.result(r)
+		}
+		if d.progress != nil {
+			d.progress(done, len(hashes))
+		}
+	}
+
+	hashesCh := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < d.workers && i < len(hashes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hash := range hashesCh {
+				r := d.download(ctx, hash)
+				// Downloads aborted because of the context are not
+				// reported, as they didn't really fail.
+				if ctx.Err() != nil {
+					continue
+				}
+				report(r)
+			}
+		}()
+	}
+loop:
+	for _, hash := range hashes {
+		select {
+		case hashesCh <- hash:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(hashesCh)
+	wg.Wait()
+	return summary, ctx.Err()
+}
+
+// download downloads a single file, retrying transient errors.
+func (d *BulkDownloader) download(ctx context.Context, hash string) DownloadResult {
+	r := DownloadResult{Hash: hash}
+	r.Path, r.Err = d.Path(hash)
+	if r.Err != nil {
+		return r
+	}
+	if _, err := os.Stat(r.Path); err == nil {
+		r.Skipped = true
+		return r
+	}
+	if r.Err = os.MkdirAll(filepath.Dir(r.Path), 0700); r.Err != nil {
+		return r
+	}
+	backoff := bulkRetryBackoff
+	for retries := 0; ; retries++ {
+		_, r.Err = d.client.downloadToFile(ctx, hash, r.Path)
+		if r.Err == nil || retries == d.maxRetries {
+			return r
+		}
+		delay, shouldRetry := retryDelay(r.Err, backoff)
+		if !shouldRetry {
+			return r
+		}
+		d.client.logger.Debugf("vt: retrying download of %s in %v after error: %v", hash, delay, r.Err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return r
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,134 @@
+package vt
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBulkDownloader(t *testing.T) {
+	defer func(d time.Duration) { bulkRetryBackoff = d }(bulkRetryBackoff)
+	bulkRetryBackoff = time.Millisecond
+
+	existing := strings.Repeat("a", 64)
+	flaky := strings.Repeat("b", 40)
+	missing := strings.Repeat("c", 32)
+	ok := strings.Repeat("d", 64)
+	var failures int32
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		hash := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v3/files/"), "/download")
+		switch hash {
+		case existing:
+			t.Errorf("existing file %s was downloaded", hash)
+		case flaky:
+			if atomic.AddInt32(&failures, 1) <= 2 {
+				writeError(w, http.StatusServiceUnavailable, "TransientError")
+				return
+			}
+		case missing:
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		w.Write([]byte("content of " + hash))
+	})
+
+	dir, err := ioutil.TempDir("", "vt-bulk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var progress []int
+	results := map[string]DownloadResult{}
+	d := cli.NewBulkDownloader(dir,
+		WithDownloadWorkers(2),
+		WithDownloadProgress(func(done, total int) {
+			if total != 5 {
+				t.Errorf("got total %d, expecting 5", total)
+			}
+			progress = append(progress, done)
+		}),
+		WithDownloadResults(func(r DownloadResult) { results[r.Hash] = r }))
+
+	path, err := d.Path(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(dir, "aa", "aa", existing); path != expected {
+		t.Errorf("got path %s, expecting %s", path, expected)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("existing"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := d.Download(context.Background(),
+		[]string{existing, flaky, missing, ok, "../../etc/passwd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Downloaded != 2 || summary.Skipped != 1 || summary.Failed != 2 {
+		t.Errorf("got summary %+v", summary)
+	}
+	if !IsNotFound(summary.Errors[missing]) || summary.Errors["../../etc/passwd"] == nil {
+		t.Errorf("got errors %v", summary.Errors)
+	}
+	if len(progress) != 5 || progress[4] != 5 {
+		t.Errorf("got progress %v", progress)
+	}
+	if !results[existing].Skipped || results[ok].Err != nil || results[missing].Err == nil {
+		t.Errorf("got results %+v", results)
+	}
+	for _, hash := range []string{flaky, ok} {
+		path, _ := d.Path(hash)
+		if b, err := ioutil.ReadFile(path); err != nil || string(b) != "content of "+hash {
+			t.Errorf("got content %q, %v for %s", b, err, hash)
+		}
+	}
+
+	// Nothing is downloaded once the context is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	summary, err = cli.NewBulkDownloader(dir).Download(ctx, []string{strings.Repeat("e", 64)})
+	if err != context.Canceled || summary.Downloaded+summary.Skipped+summary.Failed != 0 {
+		t.Errorf("got summary %+v, error %v after cancelling", summary, err)
+	}
+}
+
+func TestBulkDownloaderRetriesPlainErrors(t *testing.T) {
+	defer func(d time.Duration) { bulkRetryBackoff = d }(bulkRetryBackoff)
+	bulkRetryBackoff = time.Millisecond
+
+	// Errors without a JSON body, like the ones returned by proxies, are
+	// retried too.
+	var requests int32
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("content"))
+	})
+	dir, err := ioutil.TempDir("", "vt-bulk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	summary, err := cli.NewBulkDownloader(dir).Download(context.Background(),
+		[]string{strings.Repeat("a", 64)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); summary.Downloaded != 1 || summary.Failed != 0 || n != 3 {
+		t.Errorf("got summary %+v after %d requests", summary, n)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import "sync"
+
+// Cache stores API responses together with the ETag returned by the backend
+// for them, see WithResponseCache. Keys are request URLs. Implementations
+// must be safe for concurrent use.
+type Cache interface {
+	// Get returns the ETag and body stored for the given key. The boolean is
+	// false if there's nothing stored for the key.
+	Get(key string) (etag string, body []byte, ok bool)
+	// Set stores the ETag and body for the given key, replacing any
+	// previous value.
+	Set(key string, etag string, body []byte)
+}
+
+// WithResponseCache makes the client cache the responses to GET requests
+// that include an ETag header. When a response for the same URL is already
+// in the cache the request includes an If-None-Match header, and if the
+// backend replies with a 304 (Not Modified) status the cached response is
+// returned instead, with Response.CacheHit set to true. As 304 responses
+// don't transfer any data they don't count towards the limit set with
+// WithRateLimit.
+func WithResponseCache(cache Cache) ClientOption {
+	return func(cli *Client) {
+		cli.cache = cache
+	}
+}
+
+// memoryCache is a Cache that keeps the responses in memory.
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	etag string
+	body []byte
+}
+
+// NewMemoryCache returns a Cache that keeps the responses in memory. Entries
+// are never evicted, so it's suitable only for a bounded set of URLs, like
+// those of a few objects that are polled frequently.
+func NewMemoryCache() Cache {
+	return &memoryCache{entries: make(map[string]memoryCacheEntry)}
+}
+
+func (c *memoryCache) Get(key string) (string, []byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	return e.etag, e.body, ok
+}
+
+func (c *memoryCache) Set(key string, etag string, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = memoryCacheEntry{etag: etag, body: body}
+}
@@ -16,12 +16,21 @@ package vt
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Client for interacting with VirusTotal API.
@@ -32,12 +41,345 @@ type Client struct {
 	// Agent is a string included in the User-Agent header of every request
 	// sent to VirusTotal's servers. Users of this client are encouraged to
 	// use some string that uniquely indentify the program making the requests.
+	// See WithUserAgent.
 	Agent      string
 	httpClient *http.Client
+	// sem limits the number of requests in flight, it's nil when there's no
+	// limit. See SetMaxConcurrency.
+	sem   chan struct{}
+	retry retryPolicy
+	// limiter limits the rate at which requests are sent, it's nil when
+	// there's no limit. See WithRateLimit.
+	limiter *rateLimiter
+	// pause holds all requests while the backend asks to slow down, see
+	// roundTrip.
+	pause *pauseGate
+	// baseURL is the URL against which API paths are resolved, it's nil
+	// when the client uses the default one. See WithBaseURL.
+	baseURL *url.URL
+	// logger is used for logging diagnostic messages, see WithLogger.
+	logger Logger
+	// observer is called after every request, see WithRequestObserver.
+	observer func(RequestInfo)
+	// timeout is the default timeout for requests, see WithTimeout.
+	timeout time.Duration
+	// noCompression is true if responses must not be compressed, see
+	// WithCompression.
+	noCompression bool
+	// privateScanning is true if files and URLs are scanned with Private
+	// Scanning, see WithPrivateScanning.
+	privateScanning bool
+	// cache stores the responses to GET requests, it's nil when responses
+	// are not cached. See WithResponseCache.
+	cache Cache
+	// flights de-duplicates concurrent GET requests, it's nil when they are
+	// not de-duplicated. See WithSingleflight.
+	flights *flightGroup
+	// strictAPIKey is true if the API key must have the format of VirusTotal
+	// API keys, see WithStrictAPIKey.
+	strictAPIKey bool
+	// err is the error produced by an invalid option, which is returned by
+	// every request. See New and NewClient.
+	err error
+}
+
+// retryPolicy determines which requests are retried and how.
+type retryPolicy struct {
+	// maxRetries is the maximum number of times a request is retried, zero
+	// means that requests are not retried.
+	maxRetries int
+	// classifier decides whether a request must be retried or not.
+	classifier func(*http.Response, error) bool
+	// backoff is the maximum time waited before the first retry, the time is
+	// doubled for every subsequent retry up to maxBackoff. The actual time is
+	// chosen randomly between zero and that maximum (i.e: full jitter).
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+// delay returns the time to wait before the given retry, starting at 0.
+func (p *retryPolicy) delay(retry int) time.Duration {
+	d := p.backoff
+	for i := 0; i < retry && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// ClientOption represents an option passed to NewClient.
+type ClientOption func(*Client)
+
+// WithHTTPClient specifies the HTTP client used for sending requests, which
+// can be used for setting up a proxy, a custom TLS configuration or a mock
+// transport. The API key and the rest of the headers required by VirusTotal are
+// set on every request regardless of the client used. If httpClient is nil the
+// default client is used, see DefaultHTTPClient.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(cli *Client) {
+		if httpClient == nil {
+			httpClient = DefaultHTTPClient()
+		}
+		cli.httpClient = httpClient
+	}
+}
+
+// DefaultHTTPClient returns the HTTP client used when no other client is
+// specified with WithHTTPClient. It uses a copy of http.DefaultTransport that
+// gives up if the server doesn't start sending a response within 60 seconds.
+// There's no limit on the time spent reading the response's body, so that
+// large files can be downloaded.
+func DefaultHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 60 * time.Second
+	return &http.Client{Transport: transport}
+}
+
+// WithBaseURL specifies the URL of the VirusTotal API, for using the client
+// with an on-premises VirusTotal deployment or with an API living under a
+// different base path. The default is "https://www.virustotal.com/api/v3/".
+// Paths passed to Client.URL are resolved against this URL, and URLs created
+// with the package-level URL function are rebased onto it when a request is
+// sent. The URL must be absolute, using either the http or https schemes.
+func WithBaseURL(rawURL string) ClientOption {
+	return func(cli *Client) {
+		u, err := url.Parse(rawURL)
+		if err == nil && (u.Scheme != "http" && u.Scheme != "https" || u.Host == "") {
+			err = fmt.Errorf("base URL must be an absolute http or https URL")
+		}
+		if err != nil {
+			cli.err = fmt.Errorf("invalid base URL %q: %v", rawURL, err)
+			return
+		}
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+		cli.baseURL = u
+	}
+}
+
+// WithUserAgent specifies a string that identifies the program making the
+// requests, which is included in the User-Agent header of every request along
+// with this package's version. Without it the User-Agent is "vt-go/<version>".
+func WithUserAgent(agent string) ClientOption {
+	return func(cli *Client) {
+		cli.Agent = agent
+	}
+}
+
+// WithTimeout specifies the maximum time that a request can take, including
+// the time spent reading the response's body. The timeout applies to each
+// attempt individually, so a request that times out can be retried according
+// to the retry policy (see WithRetry). A request that times out fails with an
+// error for which IsTransient returns true. Individual requests can use a
+// different timeout with WithRequestTimeout. Zero means no timeout, which is
+// the default.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(cli *Client) {
+		cli.timeout = d
+	}
+}
+
+// RequestInfo contains information about a request sent by the client, see
+// WithRequestObserver.
+type RequestInfo struct {
+	Method string
+	// URL is the request's URL, with the API key removed if it was part of
+	// the URL.
+	URL string
+	// StatusCode is the HTTP status code of the response, or zero if the
+	// request failed without receiving a response.
+	StatusCode int
+	// Err is the error that prevented receiving a response, if any.
+	Err error
+	// Attempt is the number of the attempt, starting at 1, which is greater
+	// than 1 for retried requests.
+	Attempt int
+	// Elapsed is the time elapsed between sending the request and receiving
+	// the response's headers, including any time waiting for the rate limit
+	// or the concurrency limit.
+	Elapsed time.Duration
+}
+
+// WithRequestObserver specifies a function that is called after every request
+// sent by the client, including retried requests and the requests sent by
+// iterators and feed readers. This is useful for collecting metrics or for
+// debugging. The function is called from the goroutine that sent the request
+// and it should return quickly.
+func WithRequestObserver(fn func(RequestInfo)) ClientOption {
+	return func(cli *Client) {
+		cli.observer = fn
+	}
+}
+
+// sanitizeURL returns u as a string, with the client's API key removed, even
+// if it's escaped in the URL's path.
+func (cli *Client) sanitizeURL(u *url.URL) string {
+	s := u.String()
+	if cli.APIKey != "" {
+		s = strings.ReplaceAll(s, url.PathEscape(cli.APIKey), "REDACTED")
+		s = strings.ReplaceAll(s, cli.APIKey, "REDACTED")
+	}
+	return s
+}
+
+// WithCompression specifies whether or not the server is asked to compress
+// its responses with gzip, which greatly reduces the amount of data
+// transferred while iterating large collections. Compressed responses are
+// decompressed transparently. The default is true.
+func WithCompression(b bool) ClientOption {
+	return func(cli *Client) {
+		cli.noCompression = !b
+	}
+}
+
+// WithPrivateScanning specifies whether or not files and URLs are scanned
+// with VirusTotal Private Scanning, which requires a Private Scanning license.
+// When true, the submissions made by FileScanner, URLScanner, ScanFileFromReader,
+// ScanURL and LookupOrScan, and the analyses polled by WaitForAnalysis, use the
+// /private/files, /private/urls and /private/analyses endpoints, so that
+// they are not shared with the VirusTotal community. Other functions, like
+// GetObject, iterators or Search, are not affected. Privately scanned files
+// and URLs can be retrieved with GetObject(URL("private/files/%s", id)) and
+// GetObject(URL("private/urls/%s", id)), which are available only under
+// Private Scanning. The default is false.
+func WithPrivateScanning(b bool) ClientOption {
+	return func(cli *Client) {
+		cli.privateScanning = b
+	}
+}
+
+// WithSingleflight receives a boolean that indicates whether or not concurrent
+// GET requests for the same URL are collapsed into a single request to the
+// backend, whose response, or error, is shared by all of them. This saves
+// quota when many goroutines ask for the same popular object at the same
+// time, like in a web service. Only requests in flight at the same time are
+// collapsed, use WithResponseCache for reusing responses afterwards. A
+// goroutine whose context is cancelled stops waiting for the response, but
+// the request is aborted only when all the goroutines waiting for it have
+// stopped waiting. The default is false.
+func WithSingleflight(b bool) ClientOption {
+	return func(cli *Client) {
+		if b {
+			cli.flights = &flightGroup{}
+		} else {
+			cli.flights = nil
+		}
+	}
+}
+
+// WithStrictAPIKey receives a boolean that indicates whether or not New must
+// check that the API key has the format of VirusTotal API keys, which are 64
+// hexadecimal characters. This catches mistyped or truncated keys before
+// sending any request, but it must not be used with proxies or test servers
+// that accept keys with other formats. Empty keys are always rejected by New.
+// NewClient doesn't check the API key, so this option has no effect on it. The
+// default is false.
+func WithStrictAPIKey(b bool) ClientOption {
+	return func(cli *Client) {
+		cli.strictAPIKey = b
+	}
+}
+
+// validAPIKey returns true if key has the format of VirusTotal API keys.
+func validAPIKey(key string) bool {
+	if len(key) != 64 {
+		return false
+	}
+	for _, c := range key {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// scanURL is like URL, but the path is prefixed with "private/" if the client
+// uses Private Scanning, see WithPrivateScanning.
+func (cli *Client) scanURL(pathFmt string, a ...interface{}) *url.URL {
+	if cli.privateScanning {
+		pathFmt = "private/" + pathFmt
+	}
+	return URL(pathFmt, a...)
+}
+
+// WithRetry specifies the maximum number of times a failed request is retried.
+// Which requests are retried is determined by the retry classifier, see
+// WithRetryClassifier. Only GET requests are retried, unless the request is
+// sent with WithRetryable(true).
+func WithRetry(max int) ClientOption {
+	return func(cli *Client) {
+		cli.retry.maxRetries = max
+	}
+}
+
+// WithRetryBackoff specifies the backoff between retries. The time waited
+// before a retry is chosen randomly between zero and base, and base is
+// doubled on every retry up to max. The defaults are 1 second and 30 seconds
+// respectively.
+func WithRetryBackoff(base, max time.Duration) ClientOption {
+	return func(cli *Client) {
+		cli.retry.backoff = base
+		cli.retry.maxBackoff = max
+	}
+}
+
+// WithRateLimit limits the number of requests sent to perMinute requests per
+// minute. Requests exceeding the limit wait until they can be sent, or until
+// their context is cancelled. Every request counts towards the limit,
+// including retries and the requests made by iterators for fetching pages in
+// the background. Up to perMinute requests can be sent in a burst before
+// the limit kicks in. A value of perMinute <= 0 removes the limit.
+func WithRateLimit(perMinute int) ClientOption {
+	return func(cli *Client) {
+		if perMinute > 0 {
+			cli.limiter = newRateLimiter(perMinute)
+		} else {
+			cli.limiter = nil
+		}
+	}
+}
+
+// WithRetryClassifier specifies a function that decides whether a request must
+// be retried after receiving the given response or error. Exactly one of resp
+// and err is non-nil. The default classifier is DefaultRetryClassifier, which
+// is also used if fn is nil.
+func WithRetryClassifier(fn func(resp *http.Response, err error) bool) ClientOption {
+	return func(cli *Client) {
+		if fn == nil {
+			fn = DefaultRetryClassifier
+		}
+		cli.retry.classifier = fn
+	}
+}
+
+// DefaultRetryClassifier is the retry classifier used by default. It retries
+// requests that failed with a network error, requests that were rejected due
+// to rate limiting (HTTP 429), and requests that failed because the server
+// was temporarily unavailable (HTTP 502, 503 and 504).
+func DefaultRetryClassifier(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
 }
 
 type requestOptions struct {
-	headers map[string]string
+	headers    map[string]string
+	retryable  bool
+	timeout    time.Duration
+	attributes []string
+	params     map[string]string
 }
 
 // RequestOption represents an option passed to some functions in this package.
@@ -53,6 +395,50 @@ func WithHeader(header, value string) RequestOption {
 	}
 }
 
+// WithRetryable receives a boolean that indicates whether or not the request
+// can be retried according to the client's retry policy (see WithRetry) even
+// if it's not a GET request. Use it only with requests that are safe to send
+// more than once.
+func WithRetryable(b bool) RequestOption {
+	return func(opts *requestOptions) {
+		opts.retryable = b
+	}
+}
+
+// WithRequestTimeout specifies a timeout for the request, overriding the
+// client's default timeout set with WithTimeout. See WithTimeout for details.
+func WithRequestTimeout(d time.Duration) RequestOption {
+	return func(opts *requestOptions) {
+		opts.timeout = d
+	}
+}
+
+// WithRequestAttributes specifies the attributes that the backend should
+// include in the returned object, instead of all of them. This is useful with
+// GetObject for retrieving only the attributes that are needed. Endpoints that
+// don't support selecting attributes return the full object.
+func WithRequestAttributes(attrs []string) RequestOption {
+	return func(opts *requestOptions) {
+		opts.attributes = attrs
+	}
+}
+
+// WithRequestParam specifies a query parameter to be included in the request,
+// like "relationships" for retrieving an object together with some of its
+// relationships. This allows using parameters supported by the backend that
+// don't have a dedicated option. The parameter replaces any parameter with
+// the same name already present in the URL. It can't be used for setting the
+// "attributes" parameter together with WithRequestAttributes, requests with
+// both fail with an error.
+func WithRequestParam(key, value string) RequestOption {
+	return func(opts *requestOptions) {
+		if opts.params == nil {
+			opts.params = make(map[string]string)
+		}
+		opts.params[key] = value
+	}
+}
+
 func opts(opts ...RequestOption) *requestOptions {
 	o := &requestOptions{}
 	for _, opt := range opts {
@@ -62,36 +448,382 @@ func opts(opts ...RequestOption) *requestOptions {
 }
 
 // NewClient creates a new client for interacting with the VirusTotal API using
-// the provided API key.
-func NewClient(APIKey string) *Client {
-	return &Client{APIKey: APIKey, httpClient: &http.Client{}}
+// the provided API key. NewClient never fails: if some of the options is
+// invalid, every request sent by the client fails with the option's error.
+// The API key is not validated either, so requests sent with an empty or
+// invalid key fail with an *AuthError, and WithStrictAPIKey has no effect.
+// New reports both problems right away, and it's preferred in new code.
+func NewClient(APIKey string, options ...ClientOption) *Client {
+	cli, _ := newClient(APIKey, options...)
+	return cli
 }
 
-// sendRequest sends a HTTP request to the VirusTotal REST API.
-func (cli *Client) sendRequest(method string, url *url.URL, body io.Reader, headers map[string]string) (*http.Response, error) {
-	req, err := http.NewRequest(method, url.String(), body)
+// New is like NewClient, but returns an error if some of the options is
+// invalid, or if the API key is empty or, when using WithStrictAPIKey, it
+// doesn't look like a VirusTotal API key.
+func New(APIKey string, options ...ClientOption) (*Client, error) {
+	cli, err := newClient(APIKey, options...)
 	if err != nil {
 		return nil, err
 	}
-	agent := cli.Agent
-	if agent == "" {
-		agent = "unknown"
+	if APIKey == "" {
+		return nil, errors.New("API key is empty")
+	}
+	if cli.strictAPIKey && !validAPIKey(APIKey) {
+		return nil, errors.New("API key must be 64 hexadecimal characters")
+	}
+	return cli, nil
+}
+
+// newClient creates a client with the given options. If some of them is
+// invalid the client is returned together with the option's error, which is
+// also returned by every request sent with the client.
+func newClient(APIKey string, options ...ClientOption) (*Client, error) {
+	cli := &Client{
+		APIKey:     APIKey,
+		httpClient: DefaultHTTPClient(),
+		logger:     nopLogger{},
+		pause:      &pauseGate{},
+		retry: retryPolicy{
+			classifier: DefaultRetryClassifier,
+			backoff:    time.Second,
+			maxBackoff: 30 * time.Second,
+		},
+	}
+	for _, opt := range options {
+		opt(cli)
+	}
+	// Use a copy of the HTTP client that doesn't forward the API key when
+	// redirected to other hosts, like the ones serving file downloads.
+	httpClient := *cli.httpClient
+	httpClient.CheckRedirect = stripAPIKey(httpClient.CheckRedirect)
+	cli.httpClient = &httpClient
+	return cli, cli.err
+}
+
+// stripAPIKey returns a redirect policy for http.Client that removes the API
+// key from requests redirected to a host other than the original one, and
+// then applies the given policy. Notice that http.Client only removes standard
+// headers like Authorization by itself. If checkRedirect is nil it applies the
+// default policy of stopping after 10 redirects.
+func stripAPIKey(checkRedirect func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if req.URL.Host != via[0].URL.Host {
+			req.Header.Del("X-Apikey")
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+// URL is like the package-level URL function, but the path is resolved
+// against the client's base URL. See WithBaseURL.
+func (cli *Client) URL(pathFmt string, a ...interface{}) *url.URL {
+	return cli.resolve(URL(pathFmt, a...))
+}
+
+// resolve returns the URL where a request for u must be sent. Relative URLs,
+// like the ones that the API can return in links, are resolved against the
+// client's base URL. If the client has a custom base URL, URLs pointing to
+// the default one are rebased onto it.
+func (cli *Client) resolve(u *url.URL) *url.URL {
+	base := cli.baseURL
+	if base == nil {
+		base = &baseURL
+	}
+	if !u.IsAbs() {
+		return base.ResolveReference(u)
+	}
+	prefix := "/" + strings.TrimPrefix(baseURL.Path, "/")
+	if cli.baseURL == nil || u.Host != baseURL.Host || !strings.HasPrefix(u.Path, prefix) {
+		return u
+	}
+	rel := *u
+	rel.Scheme = ""
+	rel.Host = ""
+	rel.Path = strings.TrimPrefix(u.Path, prefix)
+	rel.RawPath = strings.TrimPrefix(u.RawPath, prefix)
+	return cli.baseURL.ResolveReference(&rel)
+}
+
+// SetMaxConcurrency limits the number of requests that can be in flight at the
+// same time to n. Requests exceeding the limit wait until some of the in-flight
+// requests finishes, or until their context is cancelled. A request is in
+// flight until its response's body is closed. A value of n <= 0 removes the
+// limit. This should be called before using the client.
+func (cli *Client) SetMaxConcurrency(n int) {
+	if n > 0 {
+		cli.sem = make(chan struct{}, n)
+	} else {
+		cli.sem = nil
+	}
+}
+
+// AvailableTokens returns the number of requests that can be sent right away
+// without exceeding the rate limit set with WithRateLimit. It returns -1 if the
+// client doesn't have a rate limit.
+func (cli *Client) AvailableTokens() int {
+	if cli.limiter == nil {
+		return -1
+	}
+	return cli.limiter.available()
+}
+
+// releasingBody is a response body that calls release when closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// requestURL returns the URL to which a request for url is actually sent,
+// including the query parameters added by the request options.
+func (cli *Client) requestURL(url *url.URL, o *requestOptions) *url.URL {
+	url = cli.resolve(url)
+	if len(o.attributes) > 0 || len(o.params) > 0 {
+		u := *url
+		q := u.Query()
+		for k, v := range o.params {
+			q.Set(k, v)
+		}
+		if len(o.attributes) > 0 {
+			q.Set("attributes", strings.Join(o.attributes, ","))
+		}
+		u.RawQuery = q.Encode()
+		url = &u
+	}
+	return url
+}
+
+// sendRequest sends a HTTP request to the VirusTotal REST API. The request is
+// aborted if the context is cancelled. Failed requests are retried according
+// to the client's retry policy, the number of attempts made is returned along
+// with the response of the last one.
+func (cli *Client) sendRequest(ctx context.Context, method string, url *url.URL, body io.Reader, o *requestOptions) (*http.Response, int, error) {
+	if cli.err != nil {
+		return nil, 0, cli.err
+	}
+	if _, ok := o.params["attributes"]; ok && len(o.attributes) > 0 {
+		return nil, 0, errors.New("WithRequestParam(\"attributes\", ...) and WithRequestAttributes can't be used together")
+	}
+	retryable := (method == "GET" || o.retryable) && cli.retry.maxRetries > 0
+	if retryable && body != nil {
+		// The body must be sent again on every retry, so it's buffered unless
+		// it's a type that http.NewRequest already knows how to rewind.
+		switch body.(type) {
+		case *bytes.Buffer, *bytes.Reader, *strings.Reader:
+		default:
+			b, err := ioutil.ReadAll(body)
+			if err != nil {
+				return nil, 0, err
+			}
+			body = bytes.NewReader(b)
+		}
+	}
+	url = cli.requestURL(url, o)
+	req, err := http.NewRequestWithContext(ctx, method, url.String(), body)
+	if err != nil {
+		return nil, 0, err
+	}
+	agent := "vt-go/" + Version
+	if cli.Agent != "" {
+		agent = cli.Agent + "; " + agent
 	}
 	// AppEngine server decides whether or not it should serve gzipped content
 	// based on Accept-Encoding and User-Agent. Non-standard UAs are not served
 	// with gzipped content unless it contains the string "gzip" somewhere.
 	// See: https://cloud.google.com/appengine/kb/#compression
-	req.Header.Set("User-Agent", fmt.Sprintf("%s; vtgo %s; gzip", agent, version))
-	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("User-Agent", agent+"; gzip")
+	if cli.noCompression {
+		// Setting the header prevents the transport from asking for gzip
+		// by itself.
+		req.Header.Set("Accept-Encoding", "identity")
+	} else {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
 	req.Header.Set("X-Apikey", cli.APIKey)
 
-	if headers != nil {
-		for k, v := range headers {
+	if o.headers != nil {
+		for k, v := range o.headers {
 			req.Header.Set(k, v)
 		}
 	}
 
-	return (cli.httpClient).Do(req)
+	timeout := cli.timeout
+	if o.timeout > 0 {
+		timeout = o.timeout
+	}
+
+	for attempt := 1; ; attempt++ {
+		attemptReq, cancel := req, context.CancelFunc(func() {})
+		if timeout > 0 {
+			var attemptCtx context.Context
+			attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+			attemptReq = req.WithContext(attemptCtx)
+		}
+		start := time.Now()
+		resp, err := cli.roundTrip(attemptReq)
+		if cli.observer != nil {
+			info := RequestInfo{
+				Method:  method,
+				URL:     cli.sanitizeURL(req.URL),
+				Err:     err,
+				Attempt: attempt,
+				Elapsed: time.Since(start),
+			}
+			if resp != nil {
+				info.StatusCode = resp.StatusCode
+			}
+			cli.observer(info)
+		}
+		// Requests rejected because of the credentials are never retried,
+		// as retrying them would fail again.
+		unauthorized := resp != nil && resp.StatusCode == http.StatusUnauthorized
+		if !retryable || attempt > cli.retry.maxRetries || unauthorized ||
+			ctx.Err() != nil || !cli.retry.classifier(resp, err) {
+			if err != nil {
+				cancel()
+				return nil, attempt, err
+			}
+			// The timeout also applies to reading the body, so the context
+			// is cancelled once the body is closed.
+			resp.Body = &releasingBody{ReadCloser: resp.Body, release: cancel}
+			decompress(resp)
+			return resp, attempt, nil
+		}
+		reason := fmt.Sprint(err)
+		if resp != nil {
+			reason = resp.Status
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		cancel()
+		delay := cli.retry.delay(attempt - 1)
+		cli.logger.Debugf("vt: retrying %s %s in %v after attempt %d failed: %s",
+			method, cli.sanitizeURL(req.URL), delay, attempt, reason)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, attempt, ctx.Err()
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, attempt, err
+			}
+		}
+	}
+}
+
+// roundTrip sends a request using the underlying HTTP client, waiting before
+// if the backend asked to slow down, or if the rate limit or the maximum
+// number of requests in flight has been reached.
+func (cli *Client) roundTrip(req *http.Request) (*http.Response, error) {
+	if err := cli.pause.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	if cli.limiter != nil {
+		if cli.limiter.available() < 1 {
+			cli.logger.Debugf("vt: rate limit reached, waiting for sending %s %s",
+				req.Method, cli.sanitizeURL(req.URL))
+		}
+		if err := cli.limiter.wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	sem := cli.sem
+	if sem == nil {
+		resp, err := (cli.httpClient).Do(req)
+		cli.checkTooManyRequests(resp)
+		return resp, err
+	}
+
+	select {
+	case sem <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	release := func() { <-sem }
+
+	resp, err := (cli.httpClient).Do(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	cli.checkTooManyRequests(resp)
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// checkTooManyRequests pauses all the requests sent by the client if resp is
+// a 429 (Too Many Requests) response with a Retry-After header, until the
+// time indicated by the header has passed. Requests waiting for the pause to
+// end return early if their context is cancelled. When the pause ends, requests
+// are sent at the rate set with WithRateLimit, if any, instead of all at once.
+func (cli *Client) checkTooManyRequests(resp *http.Response) {
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	d := parseRetryAfter(resp.Header.Get("Retry-After"))
+	if d <= 0 {
+		return
+	}
+	cli.logger.Debugf("vt: pausing requests for %v after %s %s was rejected with %s",
+		d, resp.Request.Method, cli.sanitizeURL(resp.Request.URL), resp.Status)
+	cli.pause.pause(d)
+	if cli.limiter != nil {
+		cli.limiter.drain()
+	}
+}
+
+// gzipBody is a response body that decompresses the gzipped content read from
+// body. The gzip reader is created on the first call to Read, so that errors
+// reading the gzip header are returned by Read.
+type gzipBody struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.zr == nil && b.err == nil {
+		b.zr, b.err = gzip.NewReader(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.zr.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	if b.zr != nil {
+		b.zr.Close()
+	}
+	return b.body.Close()
+}
+
+// decompress replaces the body of a gzipped response with one that returns the
+// uncompressed content.
+func decompress(resp *http.Response) {
+	if resp.ContentLength == 0 ||
+		!strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return
+	}
+	resp.Body = &gzipBody{body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
 }
 
 // parseResponse parses a HTTP response received from the VirusTotal REST API.
@@ -101,52 +833,225 @@ func (cli *Client) sendRequest(method string, url *url.URL, body io.Reader, head
 // Notice that this means that both return values can be non-nil.
 func (cli *Client) parseResponse(resp *http.Response) (*Response, error) {
 
-	apiresp := &Response{}
+	apiresp := &Response{StatusCode: resp.StatusCode, Header: resp.Header}
 
 	if resp.ContentLength == 0 {
-		return apiresp, nil
+		return apiresp, cli.statusError(resp)
 	}
 
 	// If the response has some content its format should be JSON
 	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		if err := cli.statusError(resp); err != nil {
+			return nil, err
+		}
 		return nil, fmt.Errorf("Expecting JSON response from %s %s",
-			resp.Request.Method, resp.Request.URL.String())
+			resp.Request.Method, cli.sanitizeURL(resp.Request.URL))
 	}
 
-	// Prepare gzip reader for uncompressing gzipped JSON response
-	ungzipper, err := gzip.NewReader(resp.Body)
+	if err := json.NewDecoder(resp.Body).Decode(apiresp); err != nil {
+		return nil, err
+	}
+
+	// Check if the response was an error
+	if apiresp.Error.Code != "" {
+		return apiresp, apiresp.Error
+	}
+
+	return apiresp, cli.statusError(resp)
+}
+
+// statusError returns an Error if the HTTP status code of the response
+// indicates an error, or nil if otherwise. This is used for error responses
+// that don't contain the error details in JSON format.
+func (cli *Client) statusError(resp *http.Response) error {
+	if resp.StatusCode < 400 {
+		return nil
+	}
+	return Error{Message: fmt.Sprintf("%s %s: %s",
+		resp.Request.Method, cli.sanitizeURL(resp.Request.URL), resp.Status)}
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which can be
+// either a number of seconds or a date. It returns zero if the value is empty
+// or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// doRequest sends a request with sendRequest and parses the response with
+// parseResponse. API errors returned by this function include the HTTP status
+// code and the time elapsed since the request was sent.
+func (cli *Client) doRequest(ctx context.Context, method string, url *url.URL, body io.Reader, o *requestOptions) (*Response, error) {
+	var cacheKey string
+	if cli.cache != nil && method == "GET" {
+		cacheKey = cli.requestURL(url, o).String()
+		if etag, _, ok := cli.cache.Get(cacheKey); ok {
+			withETag := *o
+			withETag.headers = map[string]string{"If-None-Match": etag}
+			for k, v := range o.headers {
+				withETag.headers[k] = v
+			}
+			o = &withETag
+		}
+	}
+	start := time.Now()
+	httpResp, attempts, err := cli.sendRequest(ctx, method, url, body, o)
 	if err != nil {
 		return nil, err
 	}
-	defer ungzipper.Close()
+	defer httpResp.Body.Close()
+	// cached is the response body that must be stored in the cache if it's
+	// parsed without errors.
+	var cached []byte
+	etag := httpResp.Header.Get("ETag")
+	if cacheKey != "" {
+		if httpResp.StatusCode == http.StatusNotModified {
+			return cli.cachedResponse(cacheKey, httpResp, attempts)
+		}
+		if etag != "" && httpResp.StatusCode == http.StatusOK {
+			if cached, err = ioutil.ReadAll(httpResp.Body); err != nil {
+				return nil, err
+			}
+			httpResp.Body = ioutil.NopCloser(bytes.NewReader(cached))
+		}
+	}
+	resp, err := cli.parseResponse(httpResp)
+	if resp != nil {
+		resp.Attempts = attempts
+	}
+	if cached != nil && err == nil {
+		cli.cache.Set(cacheKey, etag, cached)
+	}
+	err = annotateError(err, httpResp, start)
+	if apiErr, ok := apiError(err); ok && resp != nil {
+		resp.Error = apiErr
+	}
+	return resp, err
+}
 
-	if err := json.NewDecoder(ungzipper).Decode(apiresp); err != nil {
+// getPage sends a GET request for a page of a collection, calling fn with the
+// JSON of each object in the page as it's read from the response's body, see
+// decodePage. Error responses are handled like in doRequest, but the response
+// is never cached nor shared with other requests, as that requires reading
+// the whole body in memory.
+func (cli *Client) getPage(ctx context.Context, url *url.URL, fn func(json.RawMessage) error, o *requestOptions) (*Response, error) {
+	start := time.Now()
+	httpResp, attempts, err := cli.sendRequest(ctx, "GET", url, nil, o)
+	if err != nil {
 		return nil, err
 	}
+	defer httpResp.Body.Close()
+	var resp *Response
+	if httpResp.StatusCode >= 400 || httpResp.ContentLength == 0 ||
+		!strings.HasPrefix(httpResp.Header.Get("Content-Type"), "application/json") {
+		resp, err = cli.parseResponse(httpResp)
+	} else if resp, err = decodePage(httpResp.Body, fn); err == nil {
+		resp.StatusCode = httpResp.StatusCode
+		resp.Header = httpResp.Header
+		if resp.Error.Code != "" {
+			err = resp.Error
+		}
+	}
+	if resp != nil {
+		resp.Attempts = attempts
+	}
+	err = annotateError(err, httpResp, start)
+	if apiErr, ok := apiError(err); ok && resp != nil {
+		resp.Error = apiErr
+	}
+	return resp, err
+}
 
-	// Check if the response was an error
-	if apiresp.Error.Code != "" {
-		return apiresp, apiresp.Error
+// annotateError adds to err, if it's an API error, the HTTP status code and
+// the Retry-After header of the response that contained it, and the time
+// elapsed since the request was sent at start. API errors with a 401 status
+// are wrapped in an *AuthError. Other errors are returned as is.
+func annotateError(err error, httpResp *http.Response, start time.Time) error {
+	apiErr, ok := err.(Error)
+	if !ok {
+		return err
+	}
+	apiErr.HTTPStatus = httpResp.StatusCode
+	apiErr.Elapsed = time.Since(start)
+	apiErr.RetryAfter = parseRetryAfter(httpResp.Header.Get("Retry-After"))
+	if apiErr.HTTPStatus == http.StatusUnauthorized {
+		return &AuthError{Err: apiErr}
 	}
+	return apiErr
+}
 
-	return apiresp, nil
+// responseError returns the error contained in a response with an error
+// status, annotated like the errors returned by doRequest. It's used by the
+// functions that send requests with sendRequest for reading the response's
+// body by themselves, like downloads.
+func (cli *Client) responseError(httpResp *http.Response, start time.Time) error {
+	_, err := cli.parseResponse(httpResp)
+	return annotateError(err, httpResp, start)
+}
+
+// cachedResponse returns the response stored in the cache with the given key,
+// after the backend replied with a 304 (Not Modified) status to a request for
+// it.
+func (cli *Client) cachedResponse(key string, httpResp *http.Response, attempts int) (*Response, error) {
+	if cli.limiter != nil {
+		cli.limiter.refund()
+	}
+	_, b, ok := cli.cache.Get(key)
+	if !ok {
+		return nil, fmt.Errorf("response for %s not found in cache", key)
+	}
+	resp := &Response{}
+	if err := json.Unmarshal(b, resp); err != nil {
+		return nil, err
+	}
+	resp.StatusCode = httpResp.StatusCode
+	resp.Header = httpResp.Header
+	resp.Attempts = attempts
+	resp.CacheHit = true
+	return resp, nil
 }
 
 // Get sends a GET request to the specified API endpoint. This is a low level
 // primitive that returns a Response struct, where the response's data is in
 // raw form. See GetObject and GetData for higher level primitives.
 func (cli *Client) Get(url *url.URL, options ...RequestOption) (*Response, error) {
+	return cli.GetWithContext(context.Background(), url, options...)
+}
+
+// GetWithContext is like Get, but the request is aborted if the context is
+// cancelled.
+func (cli *Client) GetWithContext(ctx context.Context, url *url.URL, options ...RequestOption) (*Response, error) {
 	o := opts(options...)
-	httpResp, err := cli.sendRequest("GET", url, nil, o.headers)
-	if err != nil {
-		return nil, err
+	// Requests with custom headers are not collapsed, as the headers may
+	// change the response.
+	if cli.flights == nil || len(o.headers) > 0 {
+		return cli.doRequest(ctx, "GET", url, nil, o)
 	}
-	defer httpResp.Body.Close()
-	return cli.parseResponse(httpResp)
+	key := cli.requestURL(url, o).String()
+	return cli.flights.do(ctx, key, func(ctx context.Context) (*Response, error) {
+		return cli.doRequest(ctx, "GET", url, nil, o)
+	})
 }
 
 // Post sends a POST request to the specified API endpoint.
 func (cli *Client) Post(url *url.URL, req *Request, options ...RequestOption) (*Response, error) {
+	return cli.PostWithContext(context.Background(), url, req, options...)
+}
+
+// PostWithContext is like Post, but the request is aborted if the context is
+// cancelled.
+func (cli *Client) PostWithContext(ctx context.Context, url *url.URL, req *Request, options ...RequestOption) (*Response, error) {
 	var b []byte
 	var err error
 	if req != nil {
@@ -156,16 +1061,17 @@ func (cli *Client) Post(url *url.URL, req *Request, options ...RequestOption) (*
 		}
 	}
 	o := opts(options...)
-	httpResp, err := cli.sendRequest("POST", url, bytes.NewReader(b), o.headers)
-	if err != nil {
-		return nil, err
-	}
-	defer httpResp.Body.Close()
-	return cli.parseResponse(httpResp)
+	return cli.doRequest(ctx, "POST", url, bytes.NewReader(b), o)
 }
 
 // Patch sends a PATCH request to the specified API endpoint.
 func (cli *Client) Patch(url *url.URL, req *Request, options ...RequestOption) (*Response, error) {
+	return cli.PatchWithContext(context.Background(), url, req, options...)
+}
+
+// PatchWithContext is like Patch, but the request is aborted if the context is
+// cancelled.
+func (cli *Client) PatchWithContext(ctx context.Context, url *url.URL, req *Request, options ...RequestOption) (*Response, error) {
 	var b []byte
 	var err error
 	if req != nil {
@@ -175,23 +1081,19 @@ func (cli *Client) Patch(url *url.URL, req *Request, options ...RequestOption) (
 		}
 	}
 	o := opts(options...)
-	httpResp, err := cli.sendRequest("PATCH", url, bytes.NewReader(b), o.headers)
-	if err != nil {
-		return nil, err
-	}
-	defer httpResp.Body.Close()
-	return cli.parseResponse(httpResp)
+	return cli.doRequest(ctx, "PATCH", url, bytes.NewReader(b), o)
 }
 
 // Delete sends a DELETE request to the specified API endpoint.
 func (cli *Client) Delete(url *url.URL, options ...RequestOption) (*Response, error) {
+	return cli.DeleteWithContext(context.Background(), url, options...)
+}
+
+// DeleteWithContext is like Delete, but the request is aborted if the context
+// is cancelled.
+func (cli *Client) DeleteWithContext(ctx context.Context, url *url.URL, options ...RequestOption) (*Response, error) {
 	o := opts(options...)
-	httpResp, err := cli.sendRequest("DELETE", url, nil, o.headers)
-	if err != nil {
-		return nil, err
-	}
-	defer httpResp.Body.Close()
-	return cli.parseResponse(httpResp)
+	return cli.doRequest(ctx, "DELETE", url, nil, o)
 }
 
 // GetData sends a GET request to the specified API endpoint and unmarshals the
@@ -199,7 +1101,13 @@ func (cli *Client) Delete(url *url.URL, options ...RequestOption) (*Response, er
 // into the specified target. The target must be of an appropriate type capable
 // of receiving the data returned by the the endpoint.
 func (cli *Client) GetData(url *url.URL, target interface{}, options ...RequestOption) (*Response, error) {
-	resp, err := cli.Get(url, options...)
+	return cli.GetDataWithContext(context.Background(), url, target, options...)
+}
+
+// GetDataWithContext is like GetData, but the request is aborted if the
+// context is cancelled.
+func (cli *Client) GetDataWithContext(ctx context.Context, url *url.URL, target interface{}, options ...RequestOption) (*Response, error) {
+	resp, err := cli.GetWithContext(ctx, url, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -246,17 +1154,228 @@ func (cli *Client) CreateObject(url *url.URL, obj *Object, options ...RequestOpt
 // like /files/{file_id} and /urls/{url_id}, which return an individual object
 // but not with /comments, which returns a collection of objects.
 func (cli *Client) GetObject(url *url.URL, options ...RequestOption) (*Object, error) {
+	return cli.GetObjectWithContext(context.Background(), url, options...)
+}
+
+// GetObjectWithContext is like GetObject, but the request is aborted if the
+// context is cancelled.
+func (cli *Client) GetObjectWithContext(ctx context.Context, url *url.URL, options ...RequestOption) (*Object, error) {
 	obj := &Object{}
-	if _, err := cli.GetData(url, obj, options...); err != nil {
+	if _, err := cli.GetDataWithContext(ctx, url, obj, options...); err != nil {
 		return nil, err
 	}
 	return obj, nil
 }
 
-// PatchObject modifies an existing object.
+// GetObjectWithRelationships returns the object with the given ID from the
+// given collection (i.e: "files", "domains"), including the objects related
+// to it through the given relationships, which are then returned by
+// Object.Relationship. This saves the requests needed for retrieving each
+// relationship separately when they have a few objects. The backend omits
+// relationships with too many objects, see Object.RelationshipError.
+func (cli *Client) GetObjectWithRelationships(collection, id string, rels []string) (*Object, error) {
+	return cli.GetObject(ObjectURL(collection, id),
+		WithRequestParam("relationships", strings.Join(rels, ",")))
+}
+
+// GetObjectIfModifiedSince returns the object with the given ID from the
+// given collection only if it was modified after the given time, which is
+// sent in the If-Modified-Since header. The boolean is false and the object
+// nil if the backend replied that the object didn't change. This is useful for
+// polling an object without transferring it every time. Endpoints that don't
+// support the header always return the object as modified. If the client
+// uses WithResponseCache and the backend replies that the cached response is
+// still valid, the cached object is returned as modified only if its
+// "last_modification_date" attribute is after the given time.
+func (cli *Client) GetObjectIfModifiedSince(collection, id string, since time.Time) (*Object, bool, error) {
+	resp, err := cli.Get(ObjectURL(collection, id),
+		WithHeader("If-Modified-Since", since.UTC().Format(http.TimeFormat)))
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode == http.StatusNotModified && !resp.CacheHit {
+		return nil, false, nil
+	}
+	obj := &Object{}
+	if err := json.Unmarshal(resp.Data, obj); err != nil {
+		return nil, false, err
+	}
+	if resp.CacheHit {
+		if t, err := obj.LastModified(); err == nil && !t.After(since) {
+			return nil, false, nil
+		}
+	}
+	return obj, true, nil
+}
+
+// ObjectsError is the error returned by functions that operate on multiple
+// objects at once, like GetObjects, when the operation failed for some of the
+// objects.
+type ObjectsError struct {
+	// Errors contains the error for each of the objects, in the same order in
+	// which they were passed to the function. Objects for which the operation
+	// succeeded have a nil error.
+	Errors []error
+}
+
+func (e *ObjectsError) Error() string {
+	var first error
+	n := 0
+	for _, err := range e.Errors {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			n++
+		}
+	}
+	return fmt.Sprintf("operation failed for %d of %d objects: %v", n, len(e.Errors), first)
+}
+
+type batchOptions struct {
+	workers int
+}
+
+// BatchOption represents an option passed to functions that operate on
+// multiple objects at once, like GetObjects and AddComments.
+type BatchOption func(*batchOptions)
+
+// GetObjectsOption represents an option passed to GetObjects.
+type GetObjectsOption = BatchOption
+
+// WithWorkers specifies the maximum number of requests sent concurrently by
+// functions that operate on multiple objects at once. The default is 10.
+func WithWorkers(n int) BatchOption {
+	return func(o *batchOptions) {
+		o.workers = n
+	}
+}
+
+// batch calls fn for every integer between 0 and n-1, using as many
+// goroutines as specified by the options. It returns an *ObjectsError if fn
+// fails for some of them.
+func batch(n int, options []BatchOption, fn func(i int) error) error {
+	o := batchOptions{workers: 10}
+	for _, opt := range options {
+		opt(&o)
+	}
+	if o.workers <= 0 {
+		o.workers = 1
+	}
+	errs := make([]error, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < o.workers && i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return &ObjectsError{Errors: errs}
+		}
+	}
+	return nil
+}
+
+// GetObjects retrieves the objects with the given IDs from a collection, like
+// "files" or "domains", sending the requests concurrently. The objects are
+// returned in the same order as the IDs. If some of the objects couldn't be
+// retrieved, for example because they don't exist, the corresponding entries
+// are nil and the error is an *ObjectsError containing the error for each of
+// them. The requests are subject to the client's rate limit, if any.
+func (cli *Client) GetObjects(collection string, ids []string, options ...BatchOption) ([]*Object, error) {
+	objs := make([]*Object, len(ids))
+	err := batch(len(ids), options, func(i int) (err error) {
+		objs[i], err = cli.GetObject(ObjectURL(collection, ids[i]))
+		return err
+	})
+	return objs, err
+}
+
+// AddComment adds a comment to the object with the given ID in a collection,
+// like "files" or "urls", and returns the created comment. The text is sent
+// verbatim, words starting with "#" are interpreted as tags by VirusTotal.
+func (cli *Client) AddComment(collection, id, text string) (*Object, error) {
+	if text == "" {
+		return nil, fmt.Errorf("comment text can't be empty")
+	}
+	comment := NewObject()
+	comment.Type = "comment"
+	comment.Attributes["text"] = text
+	if err := cli.CreateObject(CommentsURL(collection, id), comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// AddVote adds a vote to the object with the given ID in a collection, like
+// "files" or "domains", and returns the created vote. The verdict must be
+// either "malicious" or "harmless". If the user already voted on the object
+// the error is an Error for which IsAlreadyExists returns true.
+func (cli *Client) AddVote(collection, id, verdict string) (*Object, error) {
+	if verdict != "malicious" && verdict != "harmless" {
+		return nil, fmt.Errorf("invalid verdict %q, must be \"malicious\" or \"harmless\"", verdict)
+	}
+	vote := NewObject()
+	vote.Type = "vote"
+	vote.Attributes["verdict"] = verdict
+	if err := cli.CreateObject(VotesURL(collection, id), vote); err != nil {
+		return nil, err
+	}
+	return vote, nil
+}
+
+// AddComments adds the same comment to the objects with the given IDs in a
+// collection, sending the requests concurrently. The created comments are
+// returned in the same order as the IDs. If the comment couldn't be added to
+// some of the objects, the corresponding entries are nil and the error is an
+// *ObjectsError containing the error for each of them. The requests are
+// subject to the client's rate limit, if any.
+func (cli *Client) AddComments(collection string, ids []string, text string, options ...BatchOption) ([]*Object, error) {
+	if text == "" {
+		return nil, fmt.Errorf("comment text can't be empty")
+	}
+	comments := make([]*Object, len(ids))
+	err := batch(len(ids), options, func(i int) (err error) {
+		comments[i], err = cli.AddComment(collection, ids[i], text)
+		return err
+	})
+	return comments, err
+}
+
+// PatchObject modifies an existing object. If some of the object's attributes
+// were modified with the SetAttribute* functions only those attributes are
+// sent, otherwise the whole object is sent. If url is nil it's derived from
+// the object's type and ID. After a successful update the object is replaced
+// by the one returned by the server, and it's not marked as modified anymore.
+//
+// Example:
+//	obj, _ := client.GetObject(vt.URL("intelligence/hunting_rulesets/%s", id))
+//	obj.SetAttributeBool("enabled", false)
+//	client.PatchObject(nil, obj)
+//
 func (cli *Client) PatchObject(url *url.URL, obj *Object, options ...RequestOption) error {
+	if url == nil {
+		var err error
+		if url, err = objectURL(obj); err != nil {
+			return err
+		}
+	}
 	req := &Request{}
 	req.Data = obj
+	if obj.IsModified() {
+		req.Data = obj.modifiedObject()
+	}
 	resp, err := cli.Patch(url, req, options...)
 	if err != nil {
 		return err
@@ -264,19 +1383,164 @@ func (cli *Client) PatchObject(url *url.URL, obj *Object, options ...RequestOpti
 	return json.Unmarshal(resp.Data, obj)
 }
 
+// DeleteObject deletes the object with the given ID from a collection, like a
+// Livehunt ruleset from "intelligence/hunting_rulesets" or a comment from
+// "comments". If the object doesn't exist the error is an Error for which
+// IsNotFound returns true.
+func (cli *Client) DeleteObject(collection, id string) error {
+	_, err := cli.Delete(ObjectURL(collection, id))
+	return err
+}
+
 // DownloadFile downloads a file given its hash (SHA-256, SHA-1 or MD5). The
-// file is written into the provided io.Writer.
+// file is written into the provided io.Writer, and the number of bytes written
+// is returned. If the API redirects the download to another host, the API key
+// is not sent to that host.
 func (cli *Client) DownloadFile(hash string, w io.Writer) (int64, error) {
-	u := URL("files/%s/download", hash)
-	resp, err := cli.sendRequest("GET", u, nil, nil)
+	return cli.DownloadFileWithProgress(hash, w, nil)
+}
+
+// DownloadFileWithProgress is like DownloadFile, but calls fn as the file is
+// being written. The function receives the number of bytes written so far and
+// the file's size, which is -1 if unknown. If fn is nil this is the same as
+// DownloadFile.
+func (cli *Client) DownloadFileWithProgress(hash string, w io.Writer, fn func(written, total int64)) (int64, error) {
+	return cli.download(context.Background(), URL("files/%s/download", hash), w, fn)
+}
+
+// download writes the content returned by the given URL into w, calling fn
+// as it's being written if fn is not nil, see DownloadFileWithProgress. The
+// download is aborted if the context is cancelled.
+func (cli *Client) download(ctx context.Context, u *url.URL, w io.Writer, fn func(written, total int64)) (int64, error) {
+	start := time.Now()
+	resp, _, err := cli.sendRequest(ctx, "GET", u, nil, opts())
 	if err != nil {
 		return 0, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return 0, cli.responseError(resp, start)
+	}
+	if fn != nil {
+		w = &progressWriter{w: w, total: resp.ContentLength, fn: fn}
+	}
 	return io.Copy(w, resp.Body)
 }
 
-// Search for files using VirusTotal Intelligence query language.
+// DownloadToFile downloads a file given its hash (SHA-256, SHA-1 or MD5) and
+// saves it at the given path, returning the number of bytes written. The file
+// is written into a temporary file in the same directory, which is renamed to
+// path only after the download succeeds, so path never contains a partially
+// downloaded file. The temporary file is removed if the download fails. As
+// downloaded files are usually malware samples the file is created with mode
+// 0600, readable only by the current user.
+func (cli *Client) DownloadToFile(hash, path string) (int64, error) {
+	return cli.downloadToFile(context.Background(), hash, path)
+}
+
+// downloadToFile is like DownloadToFile, but the download is aborted if the
+// context is cancelled.
+func (cli *Client) downloadToFile(ctx context.Context, hash, path string) (int64, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	n, err := cli.download(ctx, URL("files/%s/download", hash), f, nil)
+	if err == nil {
+		err = f.Chmod(0600)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, err
+	}
+	return n, nil
+}
+
+// DownloadRange is like DownloadFile, but it resumes a previous download that
+// didn't finish. The bytes already written into w, up to the end of w, are
+// assumed to be the beginning of the file, and only the remaining bytes are
+// requested and appended. If the server doesn't support resuming the download
+// the whole file is written again from the beginning, truncating w first if
+// it has a Truncate method, like *os.File. The file's total size is returned
+// if reported by the server, or -1 otherwise, so that callers can verify that
+// the download is complete.
+func (cli *Client) DownloadRange(hash string, w io.WriteSeeker) (int64, error) {
+	offset, err := w.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1, err
+	}
+	u := URL("files/%s/download", hash)
+	o := opts(
+		WithHeader("Range", fmt.Sprintf("bytes=%d-", offset)),
+		// Ranges refer to the uncompressed content.
+		WithHeader("Accept-Encoding", "identity"))
+	start := time.Now()
+	resp, _, err := cli.sendRequest(context.Background(), "GET", u, nil, o)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+	total := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		var start, end int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil {
+			total = -1
+		} else if start != offset {
+			return -1, fmt.Errorf("expecting content starting at byte %d, got %d", offset, start)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The file is already complete.
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes */%d", &total); err != nil {
+			total = -1
+		}
+		return total, nil
+	case http.StatusOK:
+		// The range was ignored and the whole file is being sent.
+		if t, ok := w.(interface{ Truncate(int64) error }); ok {
+			if err := t.Truncate(0); err != nil {
+				return -1, err
+			}
+		}
+		if _, err := w.Seek(0, io.SeekStart); err != nil {
+			return -1, err
+		}
+		total = resp.ContentLength
+	default:
+		return -1, cli.responseError(resp, start)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return total, err
+}
+
+// progressWriter is an io.Writer that calls fn after every write with the
+// number of bytes written so far.
+type progressWriter struct {
+	w       io.Writer
+	written int64
+	total   int64
+	fn      func(written, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+	p.fn(p.written, p.total)
+	return n, err
+}
+
+// Search for files using VirusTotal Intelligence query language. The returned
+// iterator accepts the usual options, like WithLimit, WithBatchSize and
+// WithCursor. WithOrder sorts the results by some field (i.e:
+// "first_submission_date-"), and WithDescriptorsOnly(true) returns only the
+// IDs of the matching files, which is faster for large result sets.
+// Searching requires a VirusTotal Intelligence subscription.
 func (cli *Client) Search(query string, options ...IteratorOption) (*Iterator, error) {
 	u := URL("intelligence/search")
 	q := u.Query()
@@ -285,6 +1549,20 @@ func (cli *Client) Search(query string, options ...IteratorOption) (*Iterator, e
 	return newIterator(cli, u, options...)
 }
 
+// GlobalSearch searches for files, URLs, domains, IP addresses and comments
+// matching the given query, which can be a hash, URL, domain, IP address or
+// tag comment. This is the same search performed by VirusTotal's web interface
+// and doesn't require a VirusTotal Intelligence subscription. The objects
+// returned by the iterator can be of different types, use the object's Type
+// field for telling them apart.
+func (cli *Client) GlobalSearch(query string, options ...IteratorOption) (*Iterator, error) {
+	u := URL("search")
+	q := u.Query()
+	q.Add("query", query)
+	u.RawQuery = q.Encode()
+	return newIterator(cli, u, options...)
+}
+
 // Metadata describes the structure returned by /api/v3/metadata with metadata
 // about VirusTotal, including the relationships supported by each object type.
 type Metadata struct {
@@ -308,6 +1586,18 @@ type RelationshipMeta struct {
 	Description string `json:"description" yaml:"description"`
 }
 
+// Verify checks that the API key is valid and that VirusTotal is reachable by
+// retrieving the user that owns the API key, which takes a single request
+// that is subject to the client's rate limit. It returns nil on success, an
+// *AuthError if the API key is invalid, or the error that prevented the
+// request from reaching the backend, for which IsTransient usually returns
+// true. This is useful for checking the client's configuration before
+// starting a long job.
+func (cli *Client) Verify(ctx context.Context) error {
+	_, err := cli.GetWithContext(ctx, URL("users/%s", url.PathEscape(cli.APIKey)))
+	return err
+}
+
 // GetMetadata retrieves VirusTotal metadata by calling the /api/v3/metadata
 // endpoint.
 func (cli *Client) GetMetadata() (*Metadata, error) {
@@ -0,0 +1,1405 @@
+package vt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientSetMaxConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int32
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		writeResponse(w, http.StatusOK, map[string]interface{}{"data": "ok"})
+	})
+	cli.SetMaxConcurrency(3)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cli.Get(URL("metadata")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if m := atomic.LoadInt32(&maxInFlight); m > 3 {
+		t.Errorf("%d requests were in flight simultaneously, the limit is 3", m)
+	}
+}
+
+func TestErrorHTTPStatusAndElapsed(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		if r.URL.Path == "/api/v3/plain" {
+			http.Error(w, "oops", http.StatusInternalServerError)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "InternalError")
+	})
+	check := func(err error, code string) {
+		t.Helper()
+		apiErr, ok := err.(Error)
+		if !ok {
+			t.Fatalf("expecting Error, got %T: %v", err, err)
+		}
+		if apiErr.Code != code {
+			t.Errorf("got code %q, expecting %q", apiErr.Code, code)
+		}
+		if apiErr.HTTPStatus != http.StatusInternalServerError {
+			t.Errorf("got HTTP status %d, expecting 500", apiErr.HTTPStatus)
+		}
+		if apiErr.Elapsed < 10*time.Millisecond {
+			t.Errorf("got elapsed time %v, expecting at least 10ms", apiErr.Elapsed)
+		}
+	}
+
+	_, err := cli.GetObject(URL("files/foo"))
+	check(err, "InternalError")
+
+	_, err = cli.Get(URL("plain"))
+	check(err, "")
+
+	it, err := cli.Iterator(URL("collection"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if it.Next() {
+		t.Fatal("iterator returned an object from a failing collection")
+	}
+	check(it.Error(), "InternalError")
+}
+
+func TestClientWithRetryClassifier(t *testing.T) {
+	var requests int32
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]string{"type": "file", "id": "foo"}})
+	},
+		WithRetry(5),
+		WithRetryClassifier(func(resp *http.Response, err error) bool {
+			return err == nil && resp.StatusCode == http.StatusNotFound
+		}))
+	cli.retry.backoff = time.Millisecond
+
+	obj, err := cli.GetObject(URL("files/foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.ID != "foo" || atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("got object %q after %d requests, expecting \"foo\" after 3",
+			obj.ID, requests)
+	}
+
+	// With the default classifier 404 errors are not retried.
+	atomic.StoreInt32(&requests, 0)
+	cli.retry.classifier = DefaultRetryClassifier
+	if _, err := cli.GetObject(URL("files/foo")); err == nil {
+		t.Error("expecting NotFoundError")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("request was sent %d times, expecting 1", n)
+	}
+}
+
+func TestClientAuthErrorsAreNotRetried(t *testing.T) {
+	var requests int32
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		writeError(w, http.StatusUnauthorized, "WrongCredentialsError")
+	},
+		WithRetry(5),
+		WithRetryClassifier(func(resp *http.Response, err error) bool { return true }))
+	cli.retry.backoff = time.Millisecond
+
+	_, err := cli.GetObject(URL("files/foo"))
+	var authErr *AuthError
+	if !errors.As(err, &authErr) || authErr.Err.Code != "WrongCredentialsError" || !IsAuthError(err) {
+		t.Errorf("got error %#v, expecting AuthError", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("request was sent %d times, expecting 1", n)
+	}
+}
+
+func TestNewValidatesAPIKey(t *testing.T) {
+	if _, err := New(""); err == nil {
+		t.Error("expecting error for empty API key")
+	}
+	if _, err := New("apikey"); err != nil {
+		t.Errorf("got error %v for non-strict API key", err)
+	}
+	if _, err := New("apikey", WithStrictAPIKey(true)); err == nil {
+		t.Error("expecting error for malformed API key")
+	}
+	key := strings.Repeat("0123456789abcdef", 4)
+	if _, err := New(key, WithStrictAPIKey(true)); err != nil {
+		t.Errorf("got error %v for valid API key", err)
+	}
+	// NewClient doesn't check the API key, so an unset key doesn't panic.
+	if cli := NewClient("", WithStrictAPIKey(true)); cli.APIKey != "" {
+		t.Errorf("got API key %q", cli.APIKey)
+	}
+}
+
+func TestClientWithSingleflight(t *testing.T) {
+	var requests int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		if r.URL.Path == "/api/v3/files/missing" {
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]string{"type": "file", "id": "foo"}})
+	}, WithSingleflight(true))
+
+	for _, path := range []string{"files/foo", "files/missing"} {
+		atomic.StoreInt32(&requests, 0)
+		release = make(chan struct{})
+		var wg sync.WaitGroup
+		objs := make([]*Object, 10)
+		errs := make([]error, 10)
+		for i := range objs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				objs[i], errs[i] = cli.GetObject(URL("%s", path))
+			}(i)
+		}
+		<-started
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		if n := atomic.LoadInt32(&requests); n != 1 {
+			t.Errorf("%d requests sent for %s, expecting 1", n, path)
+		}
+		for i := range objs {
+			if path == "files/foo" && (errs[i] != nil || objs[i].ID != "foo") {
+				t.Errorf("got %v, %v for %s", objs[i], errs[i], path)
+			}
+			if path == "files/missing" && !IsNotFound(errs[i]) {
+				t.Errorf("got error %v for %s", errs[i], path)
+			}
+		}
+	}
+}
+
+func TestClientWithSingleflightCancel(t *testing.T) {
+	var requests int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	aborted := make(chan struct{})
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v3/files/slow" {
+			<-r.Context().Done()
+			close(aborted)
+			return
+		}
+		atomic.AddInt32(&requests, 1)
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]string{"type": "file", "id": "foo"}})
+	}, WithSingleflight(true))
+
+	// The goroutine that sent the request gives up, but the one waiting for
+	// the same request still gets the response.
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := cli.GetObjectWithContext(ctx, URL("files/foo"))
+		first <- err
+	}()
+	<-started
+	second := make(chan error, 1)
+	go func() {
+		obj, err := cli.GetObjectWithContext(context.Background(), URL("files/foo"))
+		if err == nil && obj.ID != "foo" {
+			err = fmt.Errorf("got object %q", obj.ID)
+		}
+		second <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, expecting context.Canceled", err)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("%d requests sent, expecting 1", n)
+	}
+
+	// When every goroutine gives up the request is aborted.
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := cli.GetObjectWithContext(ctx, URL("files/slow")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, expecting context.DeadlineExceeded", err)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Error("request was not aborted")
+	}
+}
+
+func TestWithRequestParam(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("relationships") != "comments,votes" || q.Get("attributes") != "size" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]string{"type": "file", "id": "foo"}})
+	})
+	_, err := cli.GetObject(URL("files/foo"),
+		WithRequestParam("relationships", "comments,votes"),
+		WithRequestAttributes([]string{"size"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cli.GetObject(URL("files/foo"),
+		WithRequestParam("attributes", "names"),
+		WithRequestAttributes([]string{"size"}))
+	if err == nil {
+		t.Error("expecting error for conflicting attributes")
+	}
+}
+
+func TestGetObjectWithRelationships(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/file_relationships.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("relationships") != "contacted_domains,itw_url,embedded_urls" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		writeResponse(w, http.StatusOK, map[string]json.RawMessage{"data": b})
+	})
+	obj, err := cli.GetObjectWithRelationships("files",
+		"275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f",
+		[]string{"contacted_domains", "itw_url", "embedded_urls"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	domains := obj.Relationship("contacted_domains")
+	if len(domains) != 2 || domains[1].ID != "example.org" || domains[1].Type != "domain" {
+		t.Fatalf("got contacted domains %v", domains)
+	}
+	if r, ok := domains[1].Reputation(); !ok || r != -12 {
+		t.Errorf("got reputation %d, %v for %s", r, ok, domains[1].ID)
+	}
+	if urls := obj.Relationship("itw_url"); len(urls) != 1 || urls[0].ID != "0b9a2d4a3c1b" {
+		t.Errorf("got itw_url %v", urls)
+	}
+	if urls := obj.Relationship("embedded_urls"); urls != nil {
+		t.Errorf("got embedded urls %v", urls)
+	}
+	if err := obj.RelationshipError("embedded_urls"); err == nil {
+		t.Error("expecting error for embedded_urls")
+	}
+	if objs := obj.Relationship("bundled_files"); objs != nil {
+		t.Errorf("got bundled files %v", objs)
+	}
+}
+
+func TestObjectURLEscaping(t *testing.T) {
+	var paths []string
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		if strings.HasSuffix(r.URL.Path, "/votes") {
+			writeResponse(w, http.StatusOK, map[string]interface{}{"data": []interface{}{}})
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]string{"type": "comment", "id": "a/b+c"}})
+	})
+	obj, err := cli.GetObject(ObjectURL("comments", "a/b+c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, err := cli.RelationshipIterator(obj, "votes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/api/v3/comments/a%2Fb+c", "/api/v3/comments/a%2Fb+c/votes"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("got paths %v, expecting %v", paths, expected)
+	}
+}
+
+func TestGetObjectIfModifiedSince(t *testing.T) {
+	modified := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("If-Modified-Since")
+		since, err := time.Parse(http.TimeFormat, header)
+		if err != nil || !strings.HasSuffix(header, " GMT") {
+			t.Errorf("invalid If-Modified-Since header %q", header)
+		}
+		if !modified.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{"type": "collection", "id": "foo"}})
+	})
+
+	// The time is converted to GMT, regardless of its location.
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	obj, changed, err := cli.GetObjectIfModifiedSince("collections", "foo", modified.Add(-time.Hour).In(loc))
+	if err != nil || !changed || obj.ID != "foo" {
+		t.Errorf("got %v, %v, %v for older time", obj, changed, err)
+	}
+	obj, changed, err = cli.GetObjectIfModifiedSince("collections", "foo", modified.In(loc))
+	if err != nil || changed || obj != nil {
+		t.Errorf("got %v, %v, %v for modification time", obj, changed, err)
+	}
+}
+
+func TestClientVerify(t *testing.T) {
+	var requests int32
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/api/v3/users/"+r.Header.Get("X-Apikey") {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		if r.Header.Get("X-Apikey") != "apikey" {
+			writeError(w, http.StatusUnauthorized, "WrongCredentialsError")
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]string{"type": "user", "id": "foo"}})
+	})
+	if err := cli.Verify(context.Background()); err != nil {
+		t.Errorf("got error %v for valid API key", err)
+	}
+	cli.APIKey = "wrong"
+	var authErr *AuthError
+	if err := cli.Verify(context.Background()); !errors.As(err, &authErr) {
+		t.Errorf("got error %v for invalid API key", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("sent %d requests, expecting 2", n)
+	}
+
+	// The API key is in the URL's path, but it must not be in the errors.
+	cli = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+	err := cli.Verify(context.Background())
+	if err == nil || strings.Contains(err.Error(), cli.APIKey) {
+		t.Errorf("got error %v, expecting error without the API key", err)
+	}
+}
+
+func TestGlobalSearch(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/search" || r.URL.Query().Get("query") != "evil.com" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": []map[string]interface{}{
+				{"type": "domain", "id": "evil.com"},
+				{"type": "url", "id": "0b9a2d4a3c1b"},
+				{"type": "file", "id": "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"},
+				{"type": "comment", "id": "f-275a021b-1"},
+			},
+		})
+	})
+	it, err := cli.GlobalSearch("evil.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var types []string
+	for it.Next() {
+		types = append(types, it.Get().Type)
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(types, []string{"domain", "url", "file", "comment"}) {
+		t.Errorf("unexpected object types: %v", types)
+	}
+}
+
+func TestClientGetDataWithContext(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var target interface{}
+	_, err := cli.GetDataWithContext(ctx, URL("metadata"), &target)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, expecting %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request was aborted after %v", elapsed)
+	}
+}
+
+func TestClientWithRetryBackoff(t *testing.T) {
+	var requests int32
+	var bodies []string
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if atomic.AddInt32(&requests, 1)%3 != 0 {
+			writeError(w, http.StatusServiceUnavailable, "TransientError")
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{"data": "ok"})
+	}, WithRetry(3), WithRetryBackoff(time.Millisecond, 5*time.Millisecond))
+
+	resp, err := cli.Get(URL("metadata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Attempts != 3 {
+		t.Errorf("got %d attempts, expecting 3", resp.Attempts)
+	}
+
+	// POST requests are not retried unless they opt in.
+	atomic.StoreInt32(&requests, 0)
+	if _, err := cli.PostData(URL("comments"), "foo"); err == nil {
+		t.Error("expecting error from POST request")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("POST request was sent %d times, expecting 1", n)
+	}
+
+	// When they do the body is sent again on every attempt.
+	atomic.StoreInt32(&requests, 0)
+	bodies = nil
+	resp, err = cli.PostData(URL("comments"), "foo", WithRetryable(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Attempts != 3 {
+		t.Errorf("got %d attempts, expecting 3", resp.Attempts)
+	}
+	for _, b := range bodies {
+		if b != `{"data":"foo"}` {
+			t.Errorf("retried request has body %q", b)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := retryPolicy{backoff: 100 * time.Millisecond, maxBackoff: 350 * time.Millisecond}
+	for retry, max := range []time.Duration{100, 200, 350, 350, 350} {
+		for i := 0; i < 100; i++ {
+			if d := p.delay(retry); d < 0 || d >= max*time.Millisecond {
+				t.Fatalf("delay for retry %d is %v, expecting [0, %v)", retry, d, max*time.Millisecond)
+			}
+		}
+	}
+}
+
+func TestClientWithRateLimit(t *testing.T) {
+	cli := newTestClient(t, collectionHandler(testObjects(30), 10), WithRateLimit(60))
+	if n := cli.AvailableTokens(); n != 60 {
+		t.Fatalf("got %d available tokens, expecting 60", n)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := cli.Get(URL("files")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := cli.AvailableTokens(); n != 57 {
+		t.Errorf("got %d available tokens after 3 requests, expecting 57", n)
+	}
+
+	// Pages fetched by iterators consume tokens too.
+	it, err := cli.Iterator(URL("files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	if n := cli.AvailableTokens(); n != 54 {
+		t.Errorf("got %d available tokens after iterating, expecting 54", n)
+	}
+
+	// With an empty bucket requests wait until the context is done.
+	cli.limiter.mu.Lock()
+	cli.limiter.tokens = 0
+	cli.limiter.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := cli.GetWithContext(ctx, URL("files")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, expecting %v", err, context.DeadlineExceeded)
+	}
+
+	if n := NewClient("apikey").AvailableTokens(); n != -1 {
+		t.Errorf("got %d available tokens without rate limit, expecting -1", n)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestClientWithHTTPClient(t *testing.T) {
+	var header http.Header
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header = req.Header
+		w := httptest.NewRecorder()
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{"type": "file", "id": "foo"}})
+		resp := w.Result()
+		resp.Request = req
+		return resp, nil
+	})
+	cli := NewClient("apikey", WithHTTPClient(&http.Client{Transport: transport}))
+	obj, err := cli.GetObject(URL("files/foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.ID != "foo" {
+		t.Errorf("got object %q, expecting \"foo\"", obj.ID)
+	}
+	if k := header.Get("X-Apikey"); k != "apikey" {
+		t.Errorf("got API key %q, expecting \"apikey\"", k)
+	}
+
+	if cli := NewClient("apikey", WithHTTPClient(nil)); cli.httpClient == nil {
+		t.Error("expecting default HTTP client")
+	}
+}
+
+func TestClientWithBaseURL(t *testing.T) {
+	objs := testObjects(4)
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/private/api/v3/files" {
+			t.Errorf("unexpected request for %s", r.URL.Path)
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		// Return the first page with a relative link to the second one.
+		if r.URL.Query().Get("cursor") == "" {
+			writeResponse(w, http.StatusOK, map[string]interface{}{
+				"data":  objs[:2],
+				"links": map[string]string{"next": "/private/api/v3/files?cursor=2"},
+			})
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{"data": objs[2:]})
+	}))
+	defer ts.Close()
+
+	base := "https://" + ts.Listener.Addr().String() + "/private/api/v3"
+	cli, err := New("apikey", WithHTTPClient(ts.Client()), WithBaseURL(base))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := cli.URL("files/%s", "foo").String(); u != base+"/files/foo" {
+		t.Errorf("got URL %s, expecting %s", u, base+"/files/foo")
+	}
+
+	// URLs created with the package-level URL function are rebased too.
+	it, err := cli.Iterator(URL("files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, ids(got), 0, 4)
+
+	for _, invalid := range []string{"", "www.virustotal.com", "ftp://foo/", "https://%zz"} {
+		if _, err := New("apikey", WithBaseURL(invalid)); err == nil {
+			t.Errorf("expecting error for base URL %q", invalid)
+		}
+	}
+	// NewClient doesn't panic with invalid options, but every request fails.
+	cli = NewClient("apikey", WithBaseURL("ftp://foo/"))
+	if _, err := cli.GetObject(URL("files/foo")); err == nil || !strings.Contains(err.Error(), "invalid base URL") {
+		t.Errorf("got error %v, expecting invalid base URL", err)
+	}
+}
+
+func TestClientWithUserAgent(t *testing.T) {
+	var agents []string
+	h := collectionHandler(testObjects(2), 1)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.UserAgent())
+		h(w, r)
+	}
+
+	cli := newTestClient(t, handler)
+	if _, err := cli.Get(URL("files")); err != nil {
+		t.Fatal(err)
+	}
+	if want := "vt-go/" + Version + "; gzip"; agents[0] != want {
+		t.Errorf("got User-Agent %q, expecting %q", agents[0], want)
+	}
+
+	// The User-Agent is set on requests made by iterators too.
+	agents = nil
+	cli = newTestClient(t, handler, WithUserAgent("myapp/1.0"))
+	it, err := cli.Iterator(URL("files"), WithSynchronous(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.Collect(); err != nil {
+		t.Fatal(err)
+	}
+	want := "myapp/1.0; vt-go/" + Version + "; gzip"
+	for _, agent := range agents {
+		if agent != want {
+			t.Errorf("got User-Agent %q, expecting %q", agent, want)
+		}
+	}
+	if len(agents) != 2 {
+		t.Errorf("got %d requests, expecting 2", len(agents))
+	}
+}
+
+func TestClientWithCompression(t *testing.T) {
+	var acceptEncoding string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		if acceptEncoding == "gzip" {
+			writeResponse(w, http.StatusOK, map[string]interface{}{"data": "foo"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": "foo"}`))
+	}
+	for _, compression := range []bool{true, false} {
+		cli := newTestClient(t, handler, WithCompression(compression))
+		var data string
+		if _, err := cli.GetData(URL("foo"), &data); err != nil {
+			t.Fatal(err)
+		}
+		if data != "foo" {
+			t.Errorf("got data %q, expecting \"foo\"", data)
+		}
+		if (acceptEncoding == "gzip") != compression {
+			t.Errorf("got Accept-Encoding %q with compression %v", acceptEncoding, compression)
+		}
+	}
+
+	// Downloaded files are decompressed too.
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		gw.Write([]byte("file content"))
+		gw.Close()
+	})
+	var b bytes.Buffer
+	if _, err := cli.DownloadFile("foo", &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "file content" {
+		t.Errorf("got file content %q", b.String())
+	}
+}
+
+func TestClientDownloadFileWithProgress(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 100000)
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if k := r.Header.Get("X-Apikey"); k != "" {
+			t.Errorf("API key %q sent to storage host", k)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	}))
+	defer storage.Close()
+
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/files/foo/download":
+			http.Redirect(w, r, storage.URL+"/signed", http.StatusFound)
+		default:
+			writeError(w, http.StatusNotFound, "NotFoundError")
+		}
+	})
+
+	var b bytes.Buffer
+	var calls int
+	var last, total int64
+	n, err := cli.DownloadFileWithProgress("foo", &b, func(written, size int64) {
+		calls++
+		last, total = written, size
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(content)) || !bytes.Equal(b.Bytes(), content) {
+		t.Errorf("got %d bytes, expecting %d", n, len(content))
+	}
+	if calls == 0 || last != n || total != n {
+		t.Errorf("progress called %d times, last with (%d, %d)", calls, last, total)
+	}
+
+	b.Reset()
+	if _, err := cli.DownloadFile("bar", &b); err == nil {
+		t.Error("expecting error for missing file")
+	}
+	if b.Len() != 0 {
+		t.Errorf("error response written to output: %q", b.String())
+	}
+}
+
+func TestClientDownloadFileErrors(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/files/unavailable/download":
+			w.Header().Set("Retry-After", "10")
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			writeError(w, http.StatusUnauthorized, "WrongCredentialsError")
+		}
+	})
+	// Download errors are annotated like the errors of any other request.
+	_, err := cli.DownloadFile("unavailable", ioutil.Discard)
+	apiErr, ok := apiError(err)
+	if !ok || apiErr.HTTPStatus != http.StatusServiceUnavailable ||
+		apiErr.RetryAfter != 10*time.Second || !IsTransient(err) {
+		t.Errorf("got error %#v, expecting transient error", err)
+	}
+	var authErr *AuthError
+	if _, err := cli.DownloadFile("foo", ioutil.Discard); !errors.As(err, &authErr) {
+		t.Errorf("got error %#v, expecting AuthError", err)
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/notfound":
+			writeError(w, http.StatusNotFound, "NotFoundError")
+		case "/api/v3/quota":
+			writeError(w, http.StatusTooManyRequests, "QuotaExceededError")
+		case "/api/v3/auth":
+			writeError(w, http.StatusUnauthorized, "WrongCredentialsError")
+		case "/api/v3/transient":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	tests := []struct {
+		path string
+		is   func(error) bool
+	}{
+		{"notfound", IsNotFound},
+		{"quota", IsQuotaExceeded},
+		{"auth", IsAuthError},
+		{"transient", IsTransient},
+	}
+	classifiers := []func(error) bool{IsNotFound, IsQuotaExceeded, IsAuthError, IsTransient}
+	for i, test := range tests {
+		_, err := cli.GetData(URL("%s", test.path), &struct{}{})
+		if err == nil {
+			t.Fatalf("expecting error from %s", test.path)
+		}
+		// Errors are still classified when wrapped.
+		err = fmt.Errorf("wrapped: %w", err)
+		for j, is := range classifiers {
+			if is(err) != (i == j) {
+				t.Errorf("classifier %d returned %v for %s", j, is(err), test.path)
+			}
+		}
+	}
+	if IsNotFound(errors.New("not found")) || IsTransient(nil) {
+		t.Error("non-API errors must not be classified")
+	}
+}
+
+func TestClientGetObjects(t *testing.T) {
+	var inFlight, maxInFlight int32
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		id := strings.TrimPrefix(r.URL.Path, "/api/v3/files/")
+		if id == "missing" {
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]string{"type": "file", "id": id}})
+	})
+
+	ids := []string{"0", "1", "missing", "3", "4", "5"}
+	objs, err := cli.GetObjects("files", ids, WithWorkers(2))
+	var objsErr *ObjectsError
+	if !errors.As(err, &objsErr) {
+		t.Fatalf("got error %v, expecting *ObjectsError", err)
+	}
+	for i, id := range ids {
+		if id == "missing" {
+			if objs[i] != nil || !IsNotFound(objsErr.Errors[i]) {
+				t.Errorf("got %v, %v for missing object", objs[i], objsErr.Errors[i])
+			}
+		} else if objs[i] == nil || objs[i].ID != id || objsErr.Errors[i] != nil {
+			t.Errorf("got %v, %v for object %s", objs[i], objsErr.Errors[i], id)
+		}
+	}
+	if m := atomic.LoadInt32(&maxInFlight); m > 2 {
+		t.Errorf("got %d requests in flight, expecting 2 at most", m)
+	}
+
+	if _, err := cli.GetObjects("files", ids[:2]); err != nil {
+		t.Errorf("got error %v, expecting nil", err)
+	}
+}
+
+func TestClientDeleteObject(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		if r.URL.Path != "/api/v3/intelligence/hunting_rulesets/1234" {
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	if err := cli.DeleteObject("intelligence/hunting_rulesets", "1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.DeleteObject("intelligence/hunting_rulesets", "5678"); !IsNotFound(err) {
+		t.Errorf("got error %v, expecting not found", err)
+	}
+}
+
+func TestClientWithTimeout(t *testing.T) {
+	var requests int32
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// The first request is slow, so it's retried after timing out.
+		if atomic.AddInt32(&requests, 1) == 1 || r.URL.Path == "/api/v3/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{"data": "ok"})
+	}, WithTimeout(100*time.Millisecond), WithRetry(1),
+		WithRetryBackoff(time.Millisecond, time.Millisecond))
+
+	resp, err := cli.Get(URL("fast"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Attempts != 2 {
+		t.Errorf("got %d attempts, expecting 2", resp.Attempts)
+	}
+
+	_, err = cli.Get(URL("slow"))
+	if !IsTransient(err) {
+		t.Errorf("got error %v, expecting a transient error", err)
+	}
+
+	// The timeout can be overridden for individual requests.
+	if _, err := cli.Get(URL("slow"), WithRequestTimeout(time.Second)); err != nil {
+		t.Errorf("got error %v with a longer timeout", err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	h := collectionHandler(testObjects(5), 2)
+	var queries []url.Values
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/intelligence/search" {
+			t.Errorf("unexpected request: %s", r.URL.Path)
+		}
+		queries = append(queries, r.URL.Query())
+		h(w, r)
+	})
+
+	const query = "type:peexe p:5+ name:\"foo bar\""
+	it, err := cli.Search(query, WithOrder("first_submission_date-"),
+		WithDescriptorsOnly(true), WithBatchSize(2), WithLimit(3), WithSynchronous(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []*Object
+	for it.Next() {
+		got = append(got, it.Get())
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, ids(got), 0, 3)
+	q := queries[0]
+	if q.Get("query") != query || q.Get("order") != "first_submission_date-" ||
+		q.Get("descriptors_only") != "true" || q.Get("limit") != "2" {
+		t.Errorf("unexpected query parameters: %v", q)
+	}
+
+	// Resume the search where it was left.
+	it, err = cli.Search(query, WithCursor(it.Cursor()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, ids(got), 3, 5)
+}
+
+// memFile is an in-memory io.WriteSeeker with a Truncate method.
+type memFile struct {
+	b   []byte
+	pos int64
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if end := f.pos + int64(len(p)); end > int64(len(f.b)) {
+		f.b = append(f.b, make([]byte, end-int64(len(f.b)))...)
+	}
+	n := copy(f.b[f.pos:], p)
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		f.pos = offset
+	case io.SeekCurrent:
+		f.pos += offset
+	case io.SeekEnd:
+		f.pos = int64(len(f.b)) + offset
+	}
+	return f.pos, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.b = f.b[:size]
+	return nil
+}
+
+func TestClientDownloadRange(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	supportsRange := true
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var start int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err != nil {
+			t.Errorf("invalid Range header: %q", r.Header.Get("Range"))
+		}
+		switch {
+		case !supportsRange:
+			w.Write(content)
+		case start >= len(content):
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", len(content)))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		default:
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[start:])
+		}
+	})
+
+	// Resume a download that got the first 8 bytes.
+	f := &memFile{b: append([]byte{}, content[:8]...)}
+	total, err := cli.DownloadRange("foo", f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != int64(len(content)) || !bytes.Equal(f.b, content) {
+		t.Errorf("got %q with total %d", f.b, total)
+	}
+
+	// Downloading a complete file again doesn't change it.
+	if total, err = cli.DownloadRange("foo", f); err != nil || total != int64(len(content)) {
+		t.Errorf("got total %d and error %v for complete file", total, err)
+	}
+	if !bytes.Equal(f.b, content) {
+		t.Errorf("complete file changed to %q", f.b)
+	}
+
+	// If the server ignores the range the file is downloaded from scratch.
+	supportsRange = false
+	f = &memFile{b: []byte("garbage garbage garbage")}
+	if _, err = cli.DownloadRange("foo", f); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.b, content) {
+		t.Errorf("got %q after full download", f.b)
+	}
+}
+
+func TestClientWithRequestObserver(t *testing.T) {
+	var requests int32
+	var infos []RequestInfo
+	var mu sync.Mutex
+	h := collectionHandler(testObjects(3), 2)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			writeError(w, http.StatusServiceUnavailable, "TransientError")
+			return
+		}
+		h(w, r)
+	}, WithRetry(1), WithRetryBackoff(time.Millisecond, time.Millisecond),
+		WithRequestObserver(func(info RequestInfo) {
+			mu.Lock()
+			infos = append(infos, info)
+			mu.Unlock()
+		}))
+
+	if _, err := cli.Get(URL("users/%s/overall_quotas", "apikey")); err != nil {
+		t.Fatal(err)
+	}
+	it, err := cli.Iterator(URL("files"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.Collect(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(infos) != 4 {
+		t.Fatalf("observer called %d times, expecting 4: %+v", len(infos), infos)
+	}
+	if infos[0].StatusCode != http.StatusServiceUnavailable || infos[0].Attempt != 1 ||
+		infos[1].StatusCode != http.StatusOK || infos[1].Attempt != 2 {
+		t.Errorf("unexpected info for retried request: %+v", infos[:2])
+	}
+	for _, info := range infos {
+		if strings.Contains(info.URL, "apikey") {
+			t.Errorf("API key in observed URL %s", info.URL)
+		}
+		if info.Method != "GET" || info.Elapsed <= 0 {
+			t.Errorf("unexpected info: %+v", info)
+		}
+	}
+	if !strings.Contains(infos[2].URL, "/api/v3/files") {
+		t.Errorf("unexpected URL for iterator request: %s", infos[2].URL)
+	}
+}
+
+func TestClientAddComments(t *testing.T) {
+	var mu sync.Mutex
+	texts := map[string]string{}
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v3/files/"), "/comments")
+		if r.Method != "POST" || id == "missing" {
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		var req struct {
+			Data *Object `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		text, _ := req.Data.GetAttributeString("text")
+		mu.Lock()
+		texts[id] = text
+		mu.Unlock()
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"type": "comment", "id": "f-" + id,
+				"attributes": map[string]string{"text": text}}})
+	})
+
+	const text = "Dropper seen in #campaign42"
+	comments, err := cli.AddComments("files", []string{"a", "missing", "b"}, text, WithWorkers(2))
+	var objsErr *ObjectsError
+	if !errors.As(err, &objsErr) {
+		t.Fatalf("got error %v, expecting *ObjectsError", err)
+	}
+	if comments[0].ID != "f-a" || comments[1] != nil || comments[2].ID != "f-b" {
+		t.Errorf("got comments %v", comments)
+	}
+	if !IsNotFound(objsErr.Errors[1]) || objsErr.Errors[0] != nil || objsErr.Errors[2] != nil {
+		t.Errorf("got errors %v", objsErr.Errors)
+	}
+	if texts["a"] != text || texts["b"] != text {
+		t.Errorf("got comment texts %v", texts)
+	}
+
+	if _, err := cli.AddComment("files", "a", ""); err == nil {
+		t.Error("expecting error for empty comment")
+	}
+}
+
+func TestClientAddVote(t *testing.T) {
+	voted := false
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v3/domains/example.com/votes" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		if voted {
+			writeError(w, http.StatusConflict, "AlreadyExistsError")
+			return
+		}
+		voted = true
+		var req struct {
+			Data *Object `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		verdict, _ := req.Data.GetAttributeString("verdict")
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"type": "vote", "id": "d-example.com-1234",
+				"attributes": map[string]string{"verdict": verdict}}})
+	})
+
+	vote, err := cli.AddVote("domains", "example.com", "malicious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verdict, _ := vote.GetAttributeString("verdict"); vote.ID != "d-example.com-1234" || verdict != "malicious" {
+		t.Errorf("got vote %s with verdict %q", vote.ID, verdict)
+	}
+	if _, err := cli.AddVote("domains", "example.com", "harmless"); !IsAlreadyExists(err) {
+		t.Errorf("got error %v, expecting already exists", err)
+	}
+	if _, err := cli.AddVote("domains", "example.com", "evil"); err == nil {
+		t.Error("expecting error for invalid verdict")
+	}
+}
+
+func TestClientResponseStatusAndHeader(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "1234")
+		if r.URL.Path == "/api/v3/missing" {
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data":  "foo",
+			"meta":  map[string]interface{}{"count": 1},
+			"links": map[string]string{"self": "https://example.com/self"}})
+	})
+
+	var data string
+	resp, err := cli.GetData(URL("data"), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Request-Id") != "1234" {
+		t.Errorf("got status %d and request id %q", resp.StatusCode, resp.Header.Get("X-Request-Id"))
+	}
+	if data != "foo" || resp.Meta["count"] != float64(1) || resp.Links.Self != "https://example.com/self" {
+		t.Errorf("got data %q, meta %v and links %v", data, resp.Meta, resp.Links)
+	}
+
+	resp, err = cli.Get(URL("missing"))
+	if !IsNotFound(err) {
+		t.Fatalf("got error %v, expecting not found", err)
+	}
+	if resp.StatusCode != http.StatusNotFound || resp.Header.Get("X-Request-Id") != "1234" {
+		t.Errorf("got status %d and request id %q", resp.StatusCode, resp.Header.Get("X-Request-Id"))
+	}
+}
+
+func TestClientWithResponseCache(t *testing.T) {
+	version := "1"
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + version + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"type": "collection", "id": "foo",
+				"attributes": map[string]string{"version": version}}})
+	}, WithResponseCache(NewMemoryCache()), WithRateLimit(60))
+
+	tests := []struct {
+		version  string
+		cacheHit bool
+	}{
+		{"1", false},
+		{"1", true},
+		{"2", false},
+		{"2", true},
+	}
+	for i, test := range tests {
+		version = test.version
+		var obj Object
+		resp, err := cli.GetData(URL("collections/foo"), &obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := obj.GetAttributeString("version")
+		if got != test.version || resp.CacheHit != test.cacheHit {
+			t.Errorf("request %d: got version %q and cache hit %v, expecting %q and %v",
+				i, got, resp.CacheHit, test.version, test.cacheHit)
+		}
+	}
+	// Only the two requests that weren't cache hits count towards the limit.
+	if n := cli.AvailableTokens(); n != 58 {
+		t.Errorf("got %d available tokens, expecting 58", n)
+	}
+}
+
+func TestClientDownloadToFile(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/files/foo/download":
+			w.Write([]byte("file content"))
+		default:
+			writeError(w, http.StatusNotFound, "NotFoundError")
+		}
+	})
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "foo")
+	n, err := cli.DownloadToFile("foo", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 12 || string(b) != "file content" {
+		t.Errorf("got %d bytes with content %q", n, b)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("got file info %v, %v", fi, err)
+	}
+
+	if _, err := cli.DownloadToFile("bar", filepath.Join(dir, "bar")); !IsNotFound(err) {
+		t.Errorf("got error %v, expecting not found", err)
+	}
+	// Only the successfully downloaded file remains in the directory.
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 || files[0].Name() != "foo" {
+		t.Errorf("got files %v", files)
+	}
+}
+
+func TestClientWithPrivateScanning(t *testing.T) {
+	var paths []string
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"type": "private_analysis", "id": "analysis-id",
+				"attributes": map[string]string{"status": "completed"}}})
+	}, WithPrivateScanning(true))
+
+	if _, err := cli.ScanURL("http://example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.ScanFileFromReader(strings.NewReader("hello"), "hello.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.WaitForAnalysis(context.Background(), "analysis-id", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	// Object getters are not affected.
+	if _, err := cli.GetObject(URL("files/foo")); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"POST /api/v3/private/urls",
+		"POST /api/v3/private/files",
+		"GET /api/v3/private/analyses/analysis-id",
+		"GET /api/v3/files/foo",
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("got requests %v, expecting %v", paths, expected)
+	}
+}
+
+func TestClientPausesAfterTooManyRequests(t *testing.T) {
+	var limited int32
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.CompareAndSwapInt32(&limited, 0, 1) {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, "QuotaExceededError")
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{"data": "ok"})
+	})
+
+	start := time.Now()
+	if _, err := cli.Get(URL("foo")); !IsQuotaExceeded(err) {
+		t.Fatalf("got error %v, expecting quota exceeded", err)
+	}
+
+	// A request whose context expires before the pause ends returns early.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := cli.GetWithContext(ctx, URL("bar")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, expecting %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("cancelled request waited for %v", elapsed)
+	}
+
+	// Other requests wait until the time indicated by Retry-After.
+	if _, err := cli.Get(URL("bar")); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("request was sent %v after the 429 response", elapsed)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// objectDecoder decodes a sequence of objects from a reader, one at a time,
+// without reading the whole sequence in memory. The objects can be either in
+// a JSON array, like the "data" field of a collection's page, or one per
+// line, like the objects in a feed batch.
+type objectDecoder struct {
+	// dec reads the objects in a JSON array, lines reads the objects in
+	// newline-delimited JSON. Only one of them is set.
+	dec   *json.Decoder
+	lines *bufio.Reader
+	// maxLine is the maximum length of a line, longer lines are discarded.
+	maxLine int
+	// started is true once the array's opening bracket was read.
+	started bool
+	// done is true once the end of the sequence was reached.
+	done bool
+}
+
+// malformedError is the error returned by objectDecoder for an object that is
+// not valid. The decoder is positioned right after the object, so decoding can
+// continue with the following one.
+type malformedError struct {
+	err error
+}
+
+func (e *malformedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *malformedError) Unwrap() error {
+	return e.err
+}
+
+// newArrayDecoder returns an objectDecoder for objects in a JSON array. A
+// "null" is decoded as an empty array.
+func newArrayDecoder(r io.Reader) *objectDecoder {
+	return &objectDecoder{dec: json.NewDecoder(r)}
+}
+
+// newStreamDecoder returns an objectDecoder for newline-delimited objects.
+// Empty lines are ignored, and lines longer than maxLine bytes are reported as
+// malformed objects without keeping them in memory.
+func newStreamDecoder(r io.Reader, maxLine int) *objectDecoder {
+	return &objectDecoder{lines: bufio.NewReader(r), maxLine: maxLine}
+}
+
+// next returns the next object together with its JSON. It returns io.EOF
+// after the last object, and a *malformedError if the object is not valid.
+func (d *objectDecoder) next() (*Object, json.RawMessage, error) {
+	raw, err := d.nextRaw()
+	if err != nil {
+		return nil, nil, err
+	}
+	obj := &Object{}
+	if err := json.Unmarshal(raw, obj); err != nil {
+		return nil, nil, &malformedError{err}
+	}
+	return obj, raw, nil
+}
+
+// nextRaw returns the JSON of the next object without decoding it, so with
+// newline-delimited objects it may not be valid JSON. It returns io.EOF after
+// the last object.
+func (d *objectDecoder) nextRaw() (json.RawMessage, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+	if d.lines != nil {
+		return d.nextLine()
+	}
+	if !d.started {
+		t, err := d.dec.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+		d.started = true
+		if t == nil {
+			// A null array doesn't contain any objects.
+			d.done = true
+			return nil, io.EOF
+		}
+		if t != json.Delim('[') {
+			return nil, fmt.Errorf("expecting array of objects, got %v", t)
+		}
+	}
+	if !d.dec.More() {
+		// Consume the closing bracket.
+		if _, err := d.dec.Token(); err != nil {
+			return nil, err
+		}
+		d.done = true
+		return nil, io.EOF
+	}
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// nextLine returns the next non-empty line. It returns io.EOF after the last
+// line, and a *malformedError if the line is too long.
+func (d *objectDecoder) nextLine() (json.RawMessage, error) {
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line, nil
+		}
+		if d.done {
+			return nil, io.EOF
+		}
+	}
+}
+
+// readLine reads the next line. If the line is longer than maxLine it's
+// discarded and a *malformedError is returned.
+func (d *objectDecoder) readLine() ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := d.lines.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > d.maxLine {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			// The last line may not end with a newline.
+			d.done = true
+		} else if err != nil {
+			return nil, err
+		}
+		if tooLong {
+			return nil, &malformedError{
+				fmt.Errorf("line longer than %d bytes", d.maxLine)}
+		}
+		return line, nil
+	}
+}
+
+// skip discards the next n objects, including malformed ones, or all the
+// remaining objects if there are less than n.
+func (d *objectDecoder) skip(n int) error {
+	var malformed *malformedError
+	for i := 0; i < n; i++ {
+		if _, err := d.nextRaw(); err == io.EOF {
+			return nil
+		} else if err != nil && !errors.As(err, &malformed) {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodePage decodes a response containing a page of a collection, calling
+// fn with the JSON of each object in the "data" array as it's read from r, so
+// that the whole page is not read in memory. The Data field of the returned
+// Response is always nil. If fn returns an error decoding stops and the error
+// is returned.
+func decodePage(r io.Reader, fn func(json.RawMessage) error) (*Response, error) {
+	dec := json.NewDecoder(r)
+	if t, err := dec.Token(); err != nil {
+		return nil, err
+	} else if t != json.Delim('{') {
+		return nil, fmt.Errorf("expecting JSON object, got %v", t)
+	}
+	resp := &Response{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case "data":
+			objs := &objectDecoder{dec: dec}
+			for {
+				raw, err := objs.nextRaw()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					return nil, err
+				}
+				if err := fn(raw); err != nil {
+					return nil, err
+				}
+			}
+		case "meta":
+			err = dec.Decode(&resp.Meta)
+		case "links":
+			err = dec.Decode(&resp.Links)
+		case "error":
+			err = dec.Decode(&resp.Error)
+		default:
+			var ignored json.RawMessage
+			err = dec.Decode(&ignored)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Consume the closing brace.
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,125 @@
+package vt
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestObjectDecoder(t *testing.T) {
+	decode := func(d *objectDecoder) ([]string, error) {
+		var got []string
+		for {
+			obj, raw, err := d.next()
+			if err == io.EOF {
+				return got, nil
+			} else if err != nil {
+				return got, err
+			}
+			if !strings.Contains(string(raw), obj.ID) {
+				t.Errorf("JSON %s doesn't correspond to object %s", raw, obj.ID)
+			}
+			got = append(got, obj.ID)
+		}
+	}
+	tests := []struct {
+		d        *objectDecoder
+		expected int
+	}{
+		{newArrayDecoder(strings.NewReader(`[{"type": "file", "id": "0"}, {"type": "file", "id": "1"}]`)), 2},
+		{newArrayDecoder(strings.NewReader(`[]`)), 0},
+		{newArrayDecoder(strings.NewReader(`null`)), 0},
+		{newStreamDecoder(strings.NewReader("{\"type\": \"file\", \"id\": \"0\"}\n\n{\"type\": \"file\", \"id\": \"1\"}"), 100), 2},
+		{newStreamDecoder(strings.NewReader(""), 100), 0},
+	}
+	for _, test := range tests {
+		got, err := decode(test.d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, got, 0, test.expected)
+	}
+
+	// Skipping past the end isn't an error.
+	d := newArrayDecoder(strings.NewReader(`[{"id": "0"}, {"id": "1"}, {"id": "2"}]`))
+	if err := d.skip(1); err != nil {
+		t.Fatal(err)
+	}
+	if obj, _, err := d.next(); err != nil || obj.ID != "1" {
+		t.Errorf("got object %v, %v after skipping", obj, err)
+	}
+	if err := d.skip(5); err != nil {
+		t.Fatal(err)
+	}
+
+	// Decoding continues after a malformed line.
+	// Decoding continues after a malformed or too long line, and skipping
+	// counts them too.
+	lines := "{\"id\": \"0\"}\n{\"id\":\n{\"id\": \"" + strings.Repeat("x", 100) + "\"}\n{\"id\": \"1\"}"
+	d = newStreamDecoder(strings.NewReader(lines), 50)
+	var malformed *malformedError
+	if _, _, err := d.next(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := d.next(); !errors.As(err, &malformed) {
+			t.Errorf("got error %v, expecting malformed object", err)
+		}
+	}
+	if obj, _, err := d.next(); err != nil || obj.ID != "1" {
+		t.Errorf("got object %v, %v after malformed lines", obj, err)
+	}
+	d = newStreamDecoder(strings.NewReader(lines), 50)
+	if err := d.skip(3); err != nil {
+		t.Fatal(err)
+	}
+	if obj, _, err := d.next(); err != nil || obj.ID != "1" {
+		t.Errorf("got object %v, %v after skipping malformed lines", obj, err)
+	}
+
+	for _, s := range []string{``, `{"id": "0"}`, `[{"id": "0"}`} {
+		if _, err := decode(newArrayDecoder(strings.NewReader(s))); err == nil {
+			t.Errorf("expecting error for %q", s)
+		}
+	}
+}
+
+func TestDecodePage(t *testing.T) {
+	page := `{"data": [{"type": "file", "id": "0"}, {"type": "file", "id": "1"}],
+		"meta": {"cursor": "foo"}, "links": {"next": "bar"}, "other": [1, 2]}`
+	var got []string
+	resp, err := decodePage(strings.NewReader(page), func(raw json.RawMessage) error {
+		obj := &Object{}
+		if err := json.Unmarshal(raw, obj); err != nil {
+			return err
+		}
+		got = append(got, obj.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, got, 0, 2)
+	if resp.Meta["cursor"] != "foo" || resp.Links.Next != "bar" || resp.Data != nil {
+		t.Errorf("got response %+v", resp)
+	}
+
+	// Errors returned by the function stop the decoding.
+	stop := errors.New("stop")
+	calls := 0
+	_, err = decodePage(strings.NewReader(page), func(json.RawMessage) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("got error %v after %d calls", err, calls)
+	}
+
+	for _, s := range []string{``, `[]`, `{"data": [`, `{"data": {}}`} {
+		if _, err := decodePage(strings.NewReader(s), func(json.RawMessage) error { return nil }); err == nil {
+			t.Errorf("expecting error for %q", s)
+		}
+	}
+}
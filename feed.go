@@ -0,0 +1,321 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import (
+	"compress/bzip2"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// feedRetryInterval is the time waited before requesting again a batch that
+// is not available yet.
+var feedRetryInterval = time.Minute
+
+// feedMaxDelay is the time after which a batch should be available. Batches
+// that are not found and are older than this are considered missing.
+var feedMaxDelay = 2 * time.Hour
+
+// feedMaxLineSize is the maximum size of an object in a feed batch, larger
+// objects are reported as malformed.
+var feedMaxLineSize = payloadMaxSize
+
+// feedBatchFormat is the format of the time that identifies each batch.
+const feedBatchFormat = "200601021504"
+
+// MissingBatchError is the error returned by FeedReader.Next when a batch is
+// missing from the feed. This happens occasionally and it's not a fatal
+// error, the next call to Next continues with the following batch.
+type MissingBatchError struct {
+	// Time is the time of the missing batch.
+	Time time.Time
+}
+
+func (e *MissingBatchError) Error() string {
+	return fmt.Sprintf("missing feed batch %s", e.Time.Format(feedBatchFormat))
+}
+
+// MalformedObjectError is the error returned by FeedReader.Next when an object
+// in a feed batch is not valid JSON. Like MissingBatchError it's not a fatal
+// error, the next call to Next continues with the following object.
+type MalformedObjectError struct {
+	// Time is the time of the batch containing the object.
+	Time time.Time
+	// Offset is the position of the object within the batch.
+	Offset int
+	// Err is the error returned while decoding the object.
+	Err error
+}
+
+func (e *MalformedObjectError) Error() string {
+	return fmt.Sprintf("malformed object %d in feed batch %s: %v",
+		e.Offset, e.Time.Format(feedBatchFormat), e.Err)
+}
+
+// Unwrap returns the error returned while decoding the object.
+func (e *MalformedObjectError) Unwrap() error {
+	return e.Err
+}
+
+// FeedReader reads objects from one of VirusTotal's feeds, like the file and
+// URL feeds. Feeds are published in batches, one per minute, and each batch
+// contains the objects processed by VirusTotal during that minute. Batches are
+// published with some delay, the reader waits for them to be available when it
+// catches up with the live feed. FeedReader is created with Client.NewFeed.
+type FeedReader struct {
+	client   *Client
+	feedType string
+	// batchTime is the time of the batch being read, or the next batch to be
+	// read if body is nil.
+	batchTime time.Time
+	// offset is the number of objects already read from the current batch.
+	offset  int
+	decoder *objectDecoder
+	ctx     context.Context
+	cancel  context.CancelFunc
+	err     error
+	// mu protects body and closed, as Close can be called while Next is
+	// running.
+	mu     sync.Mutex
+	body   io.ReadCloser
+	closed bool
+	// lastBatchTime is the time of the batch from which the last object
+	// returned by Next was read, and lastRaw is the object's JSON.
+	lastBatchTime time.Time
+	lastRaw       json.RawMessage
+}
+
+// FeedOption represents an option passed to Client.NewFeed.
+type FeedOption func(*FeedReader)
+
+// WithStartTime specifies the time at which the feed starts being read. The
+// time is truncated to the minute. By default the feed starts one hour ago.
+func WithStartTime(t time.Time) FeedOption {
+	return func(f *FeedReader) {
+		f.batchTime = t.UTC().Truncate(time.Minute)
+	}
+}
+
+// WithFeedCursor specifies a cursor returned by FeedReader.Cursor, the feed
+// starts right after the object that was being read when the cursor was
+// obtained. Notice that VirusTotal keeps the feed batches for a limited time,
+// if the cursor is too old the batches won't be available anymore and Next
+// returns a *MissingBatchError for each of them.
+func WithFeedCursor(cursor string) FeedOption {
+	return func(f *FeedReader) {
+		if err := f.decodeCursor(cursor); err != nil {
+			f.err = fmt.Errorf("invalid feed cursor: %v", err)
+		}
+	}
+}
+
+// NewFeed returns a FeedReader for the given feed type, like "files" or
+// "urls". Reading feeds requires a VirusTotal Enterprise subscription.
+func (cli *Client) NewFeed(feedType string, options ...FeedOption) (*FeedReader, error) {
+	f := &FeedReader{
+		client:    cli,
+		feedType:  feedType,
+		batchTime: time.Now().UTC().Add(-time.Hour).Truncate(time.Minute),
+	}
+	for _, opt := range options {
+		opt(f)
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.ctx, f.cancel = context.WithCancel(context.Background())
+	return f, nil
+}
+
+// Cursor returns a token indicating the reader's position in the feed, which
+// can be passed to WithFeedCursor for resuming the feed right after the last
+// object returned by Next, even from a different process.
+func (f *FeedReader) Cursor() string {
+	c := cursor{Link: f.batchTime.Format(feedBatchFormat), Offset: f.offset}
+	return c.encode()
+}
+
+// decodeCursor sets the reader's position to the one indicated by a cursor
+// returned by Cursor.
+func (f *FeedReader) decodeCursor(s string) error {
+	c := cursor{}
+	if err := c.decode(s); err != nil {
+		return err
+	}
+	t, err := time.Parse(feedBatchFormat, c.Link)
+	if err != nil {
+		return err
+	}
+	f.batchTime = t
+	f.offset = c.Offset
+	return nil
+}
+
+// Time returns the time of the batch being read. Passing it to WithStartTime
+// allows to resume reading the feed from the current batch.
+func (f *FeedReader) Time() time.Time {
+	return f.batchTime
+}
+
+// BatchTime returns the time of the batch from which the last object returned
+// by Next was read. Unlike Time, it doesn't change until Next returns another
+// object, which makes it suitable for recording the minute of the feed each
+// object comes from, even when resuming the feed with WithFeedCursor. It
+// returns the zero time if Next didn't return any object yet.
+func (f *FeedReader) BatchTime() time.Time {
+	return f.lastBatchTime
+}
+
+// Raw returns the JSON of the last object returned by Next, exactly as found
+// in the feed batch, which is useful for archiving or auditing the feed. It
+// returns nil if Next didn't return any object yet.
+func (f *FeedReader) Raw() json.RawMessage {
+	return f.lastRaw
+}
+
+// Next returns the next object in the feed, waiting for it if the reader has
+// caught up with the live feed. If the batch being read is missing from the
+// feed, it returns a *MissingBatchError, and the next call continues with the
+// following batch. If an object in the batch is not valid JSON, it returns a
+// *MalformedObjectError, and the next call continues with the following
+// object. Other errors are returned as is, and the next call tries to read the
+// same batch again, continuing after the last object returned.
+func (f *FeedReader) Next() (*Object, error) {
+	for {
+		if !f.batchOpen() {
+			if err := f.openBatch(); err != nil {
+				if missing, ok := err.(*MissingBatchError); ok {
+					f.nextBatch()
+					return nil, missing
+				}
+				return nil, err
+			}
+			// Skip the objects already read from this batch.
+			if err := f.decoder.skip(f.offset); err != nil {
+				f.closeBatch()
+				return nil, err
+			}
+		}
+		obj, raw, err := f.decoder.next()
+		var malformed *malformedError
+		switch {
+		case err == nil:
+			f.offset++
+			f.lastBatchTime = f.batchTime
+			f.lastRaw = raw
+			return obj, nil
+		case errors.As(err, &malformed):
+			// The decoder is already past the malformed object.
+			f.offset++
+			return nil, &MalformedObjectError{
+				Time: f.batchTime, Offset: f.offset - 1, Err: malformed.err}
+		case err == io.EOF:
+			f.closeBatch()
+			f.nextBatch()
+		default:
+			f.closeBatch()
+			return nil, err
+		}
+	}
+}
+
+// batchOpen returns true if a batch is being read.
+func (f *FeedReader) batchOpen() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.body != nil
+}
+
+// closeBatch closes the body of the batch being read, if any.
+func (f *FeedReader) closeBatch() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
+
+// nextBatch moves the reader to the beginning of the next batch.
+func (f *FeedReader) nextBatch() {
+	f.batchTime = f.batchTime.Add(time.Minute)
+	f.offset = 0
+}
+
+// openBatch opens the batch at f.batchTime, waiting for it if it's not
+// available yet.
+func (f *FeedReader) openBatch() error {
+	u := URL("feeds/%s/%s", f.feedType, f.batchTime.Format(feedBatchFormat))
+	for {
+		start := time.Now()
+		resp, _, err := f.client.sendRequest(f.ctx, "GET", u, nil, opts())
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusOK {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if f.closed {
+				resp.Body.Close()
+				return context.Canceled
+			}
+			f.body = resp.Body
+			f.decoder = newStreamDecoder(bzip2.NewReader(resp.Body), feedMaxLineSize)
+			return nil
+		}
+		if resp.StatusCode != http.StatusNotFound {
+			defer resp.Body.Close()
+			if err := f.client.responseError(resp, start); err != nil {
+				return err
+			}
+			// Only a 200 status means that the batch is in the body.
+			return fmt.Errorf("unexpected status %q for %s feed batch %s",
+				resp.Status, f.feedType, f.batchTime.Format(feedBatchFormat))
+		}
+		resp.Body.Close()
+		if time.Since(f.batchTime) > feedMaxDelay {
+			f.client.logger.Errorf("vt: skipping missing %s feed batch %s",
+				f.feedType, f.batchTime.Format(feedBatchFormat))
+			return &MissingBatchError{Time: f.batchTime}
+		}
+		f.client.logger.Debugf("vt: %s feed batch %s not available yet, waiting %v",
+			f.feedType, f.batchTime.Format(feedBatchFormat), feedRetryInterval)
+		select {
+		case <-time.After(feedRetryInterval):
+		case <-f.ctx.Done():
+			return f.ctx.Err()
+		}
+	}
+}
+
+// Close stops reading the feed and releases the connection used for reading
+// the current batch. Any call to Next waiting for a batch returns with an
+// error. It's safe to call Close from a goroutine other than the one calling
+// Next.
+func (f *FeedReader) Close() {
+	f.cancel()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
@@ -0,0 +1,254 @@
+package vt
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Batches compressed with bzip2, as there's no bzip2 compressor in the
+// standard library.
+var testFeedBatches = []string{
+	// {"type":"file","id":"a"}\n{"type":"file","id":"b"}\n
+	"QlpoOTFBWSZTWaFwJb0AABdZgAAQEAQAEDckRCogADFMABNAqqGjTajJ+qRhhuuXRVUPWWljTlFkRw/F3JFOFCQoXAlvQA==",
+	// {"type":"file","id":"c"}\n
+	"QlpoOTFBWSZTWWNl1EAAAAvZgAAQEAQAEA8kRCogADFMAADUNGIafqhEXdOTKXO0yrIwY+LuSKcKEgxsuogA",
+	// {"type":"file","id":"a"}\n{"type":"file",\n{"type":"file","id":"b"}\n
+	"QlpoOTFBWSZTWffTIhwAAB9ZgAAQEAQAEDckRCogACEVR6g9IyfqhTAATSFW2bPSURvGBPTLppNPDGmMdz8XckU4UJD30yIc",
+	// {"type":"file","id":"a"}\n{"type":"file","id":"a-very-long-identifier"}\n{"type":"file","id":"b"}\n
+	"QlpoOTFBWSZTWRxgcIIAAC1ZgAAQEAYAEDel1SogAFRXpGg0NANCPUppobUyDan6oixYc3Y2ERGYMLWgzds3hJiiepLmZTlSDdsoe5EEs1DAx8XckU4UJAcYHCCA",
+}
+
+func feedHandler(t *testing.T, batches map[string]string, requests map[string]int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		batch, ok := batches[r.URL.Path]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		b, err := base64.StdEncoding.DecodeString(batch)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Write(b)
+	}
+}
+
+func TestFeedReader(t *testing.T) {
+	start := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Minute)
+	batchPath := func(minute int) string {
+		return "/api/v3/feeds/files/" + start.Add(time.Duration(minute)*time.Minute).Format("200601021504")
+	}
+	requests := map[string]int{}
+	cli := newTestClient(t, feedHandler(t, map[string]string{
+		batchPath(0): testFeedBatches[0],
+		// Batch 1 is missing.
+		batchPath(2): testFeedBatches[1],
+	}, requests))
+
+	f, err := cli.NewFeed("files", WithStartTime(start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []string
+	var batches []time.Time
+	var missing *MissingBatchError
+	if !f.BatchTime().IsZero() || f.Raw() != nil {
+		t.Errorf("got batch time %v and raw %s before reading", f.BatchTime(), f.Raw())
+	}
+	for len(got) < 3 {
+		obj, err := f.Next()
+		if errors.As(err, &missing) {
+			if !missing.Time.Equal(start.Add(time.Minute)) {
+				t.Errorf("got missing batch %v, expecting %v", missing.Time, start.Add(time.Minute))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, obj.ID)
+		batches = append(batches, f.BatchTime())
+	}
+	if missing == nil {
+		t.Error("missing batch was not reported")
+	}
+	if got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("got objects %v, expecting [a b c]", got)
+	}
+	if !f.Time().Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("got feed time %v", f.Time())
+	}
+	if !batches[0].Equal(start) || !batches[1].Equal(start) || !batches[2].Equal(start.Add(2*time.Minute)) {
+		t.Errorf("got batch times %v", batches)
+	}
+	if string(f.Raw()) != `{"type":"file","id":"c"}` {
+		t.Errorf("got raw object %s", f.Raw())
+	}
+}
+
+func TestFeedReaderWaitsForBatches(t *testing.T) {
+	defer func(d time.Duration) { feedRetryInterval = d }(feedRetryInterval)
+	feedRetryInterval = time.Millisecond
+
+	start := time.Now().UTC().Truncate(time.Minute)
+	path := "/api/v3/feeds/urls/" + start.Format("200601021504")
+	batches := map[string]string{}
+	requests := map[string]int{}
+	h := feedHandler(t, batches, requests)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// The batch becomes available after being requested a few times.
+		if requests[path] == 3 {
+			batches[path] = testFeedBatches[1]
+		}
+		h(w, r)
+	})
+
+	f, err := cli.NewFeed("urls", WithStartTime(start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	obj, err := f.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.ID != "c" || requests[path] != 4 {
+		t.Errorf("got object %q after %d requests", obj.ID, requests[path])
+	}
+}
+
+func TestFeedReaderCursor(t *testing.T) {
+	start := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Minute)
+	batchPath := func(minute int) string {
+		return "/api/v3/feeds/files/" + start.Add(time.Duration(minute)*time.Minute).Format("200601021504")
+	}
+	cli := newTestClient(t, feedHandler(t, map[string]string{
+		batchPath(0): testFeedBatches[0],
+		batchPath(1): testFeedBatches[1],
+	}, map[string]int{}))
+
+	// Resume the feed from every position and check that the object returned
+	// is the one following the position.
+	expected := []string{"a", "b", "c"}
+	cursor := ""
+	for i, id := range expected {
+		options := []FeedOption{WithStartTime(start)}
+		if cursor != "" {
+			options = append(options, WithFeedCursor(cursor))
+		}
+		f, err := cli.NewFeed("files", options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj, err := f.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.ID != id {
+			t.Errorf("got object %q after resuming at %d, expecting %q", obj.ID, i, id)
+		}
+		if batch := start.Add(time.Duration(i/2) * time.Minute); !f.BatchTime().Equal(batch) {
+			t.Errorf("got batch time %v for object %q, expecting %v", f.BatchTime(), obj.ID, batch)
+		}
+		cursor = f.Cursor()
+		f.Close()
+	}
+
+	if _, err := cli.NewFeed("files", WithFeedCursor("invalid")); err == nil {
+		t.Error("expecting error for invalid cursor")
+	}
+}
+
+func TestFeedReaderMalformedObject(t *testing.T) {
+	defer func(n int) { feedMaxLineSize = n }(feedMaxLineSize)
+	feedMaxLineSize = 30
+
+	start := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Minute)
+	// Batch 0 contains invalid JSON, and batch 1 an object that is too long.
+	cli := newTestClient(t, feedHandler(t, map[string]string{
+		"/api/v3/feeds/files/" + start.Format("200601021504"):                  testFeedBatches[2],
+		"/api/v3/feeds/files/" + start.Add(time.Minute).Format("200601021504"): testFeedBatches[3],
+	}, map[string]int{}))
+	for minute := 0; minute < 2; minute++ {
+		testMalformedObject(t, cli, start.Add(time.Duration(minute)*time.Minute))
+	}
+}
+
+// testMalformedObject checks that the feed batch at start, which contains
+// objects "a" and "b" with a malformed object between them, is read skipping
+// the malformed object.
+func testMalformedObject(t *testing.T, cli *Client, start time.Time) {
+	f, err := cli.NewFeed("files", WithStartTime(start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if obj, err := f.Next(); err != nil || obj.ID != "a" {
+		t.Fatalf("got object %v, %v", obj, err)
+	}
+	_, err = f.Next()
+	var malformed *MalformedObjectError
+	if !errors.As(err, &malformed) || malformed.Offset != 1 || !malformed.Time.Equal(start) {
+		t.Fatalf("got error %v, expecting malformed object 1", err)
+	}
+	cursor := f.Cursor()
+	// The reader continues after the malformed object, both when reading the
+	// same batch and when resuming from the cursor.
+	if obj, err := f.Next(); err != nil || obj.ID != "b" {
+		t.Fatalf("got object %v, %v after malformed object", obj, err)
+	}
+	f, err = cli.NewFeed("files", WithFeedCursor(cursor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if obj, err := f.Next(); err != nil || obj.ID != "b" {
+		t.Fatalf("got object %v, %v after resuming", obj, err)
+	}
+}
+
+func TestFeedReaderClose(t *testing.T) {
+	start := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Minute)
+	cli := newTestClient(t, feedHandler(t, map[string]string{
+		"/api/v3/feeds/files/" + start.Format("200601021504"): testFeedBatches[0],
+	}, map[string]int{}))
+
+	f, err := cli.NewFeed("files", WithStartTime(start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Next(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if f.body != nil {
+		t.Error("batch body not closed")
+	}
+	if _, err := f.Next(); err == nil {
+		t.Error("expecting error after closing the reader")
+	}
+	f.Close()
+}
+
+func TestFeedReaderUnexpectedStatus(t *testing.T) {
+	start := time.Now().UTC().Add(-3 * time.Hour).Truncate(time.Minute)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	f, err := cli.NewFeed("files", WithStartTime(start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// Statuses other than 200 are errors, even if they are successful.
+	for i := 0; i < 2; i++ {
+		if _, err := f.Next(); err == nil {
+			t.Error("expecting error for status 204")
+		}
+	}
+}
@@ -15,11 +15,15 @@ package vt
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"mime/multipart"
 	"net/url"
 	"os"
+	"time"
 )
 
 type progressReader struct {
@@ -73,14 +77,14 @@ func (s *FileScanner) Scan(r io.Reader, filename string, progress chan<- float32
 		// Payload is bigger than supported by AppEngine in a POST request,
 		// let's ask for an upload URL.
 		var u string
-		if _, err := s.cli.GetData(URL("files/upload_url"), &u); err != nil {
+		if _, err := s.cli.GetData(s.cli.scanURL("files/upload_url"), &u); err != nil {
 			return nil, err
 		}
 		if uploadURL, err = url.Parse(u); err != nil {
 			return nil, err
 		}
 	} else {
-		uploadURL = URL("files")
+		uploadURL = s.cli.scanURL("files")
 	}
 
 	pr := &progressReader{
@@ -88,15 +92,9 @@ func (s *FileScanner) Scan(r io.Reader, filename string, progress chan<- float32
 		total:      int64(b.Len()),
 		progressCh: progress}
 
-	headers := map[string]string{"Content-Type": w.FormDataContentType()}
+	o := opts(WithHeader("Content-Type", w.FormDataContentType()))
 
-	httpResp, err := s.cli.sendRequest("POST", uploadURL, pr, headers)
-	if err != nil {
-		return nil, err
-	}
-	defer httpResp.Body.Close()
-
-	apiResp, err := s.cli.parseResponse(httpResp)
+	apiResp, err := s.cli.doRequest(context.Background(), "POST", uploadURL, pr, o)
 	if err != nil {
 		return nil, err
 	}
@@ -114,3 +112,178 @@ func (s *FileScanner) Scan(r io.Reader, filename string, progress chan<- float32
 func (s *FileScanner) ScanFile(f *os.File, progress chan<- float32) (*Object, error) {
 	return s.Scan(f, f.Name(), progress)
 }
+
+// FileIDFromReader returns the identifier that VirusTotal uses for a file with
+// the content read from r, which is the SHA-256 of the content. The content is
+// hashed as it is read, without keeping it in memory. This is useful for
+// checking if a file is already known by VirusTotal with a GET request to
+// /files/{id} before uploading it.
+func FileIDFromReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LookupOrScan looks for a file with the content read from r in VirusTotal
+// and returns it if it already exists. If the file is unknown it is uploaded
+// for scanning and the returned object is the corresponding analysis. The
+// boolean result is true when a new scan was triggered. The reader must be
+// seekable because its content is read twice, once for computing the file's
+// SHA-256 and then for uploading it if required.
+func (cli *Client) LookupOrScan(r io.ReadSeeker) (*Object, bool, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, false, err
+	}
+	id, err := FileIDFromReader(r)
+	if err != nil {
+		return nil, false, err
+	}
+	obj, err := cli.GetObject(cli.scanURL("files/%s", id))
+	if err == nil {
+		return obj, false, nil
+	}
+	if !IsNotFound(err) {
+		return nil, false, err
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	obj, err = cli.NewFileScanner().Scan(r, "", nil)
+	if err != nil {
+		return nil, false, err
+	}
+	return obj, true, nil
+}
+
+// uploadProgressInterval is the minimum time between calls to the function
+// passed to WithUploadProgress.
+const uploadProgressInterval = 100 * time.Millisecond
+
+type scanOptions struct {
+	progress func(sent, total int64)
+}
+
+// ScanOption represents an option passed to ScanFileFromReader.
+type ScanOption func(*scanOptions)
+
+// WithUploadProgress specifies a function that is called while the file is
+// being uploaded, receiving the number of bytes sent so far and the file's
+// size, which is -1 if the reader is not seekable and the size is unknown. The
+// function is called at most every 100 milliseconds, plus a last time when
+// the whole file has been sent.
+func WithUploadProgress(fn func(sent, total int64)) ScanOption {
+	return func(o *scanOptions) {
+		o.progress = fn
+	}
+}
+
+// uploadProgressReader is an io.Reader that calls fn as the content is read,
+// at most once every uploadProgressInterval and at the end of the content.
+type uploadProgressReader struct {
+	r     io.Reader
+	sent  int64
+	total int64
+	fn    func(sent, total int64)
+	last  time.Time
+}
+
+func (p *uploadProgressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.sent += int64(n)
+	if now := time.Now(); err == io.EOF || now.Sub(p.last) >= uploadProgressInterval {
+		p.last = now
+		p.fn(p.sent, p.total)
+	}
+	return n, err
+}
+
+// Rescan asks VirusTotal to analyse again a file that it already knows, given
+// its hash (SHA-256, SHA-1 or MD5), and returns the new analysis object, which
+// can be passed to WaitForAnalysis.
+func (cli *Client) Rescan(hash string) (*Object, error) {
+	resp, err := cli.Post(cli.scanURL("files/%s/analyse", hash), nil)
+	if err != nil {
+		return nil, err
+	}
+	analysis := &Object{}
+	if err := json.Unmarshal(resp.Data, analysis); err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
+
+// ScanFileFromReader sends a file to VirusTotal for scanning, streaming the
+// content read from r without keeping it in memory. The file name, which can
+// be left blank, is sent as the file name in the multipart form. Files larger
+// than the limit for direct uploads are sent to an upload URL obtained from
+// /files/upload_url. If r is an io.Seeker the file size is determined in
+// advance and the upload method is chosen accordingly, otherwise the upload
+// URL is always used, as it works for files of any size. An analysis object
+// is returned as soon as the file is uploaded.
+func (cli *Client) ScanFileFromReader(r io.Reader, filename string, options ...ScanOption) (*Object, error) {
+	so := &scanOptions{}
+	for _, opt := range options {
+		opt(so)
+	}
+	uploadURL := cli.scanURL("files")
+	size := int64(-1)
+	if seeker, ok := r.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		size = end - start
+	}
+	if so.progress != nil {
+		r = &uploadProgressReader{r: r, total: size, fn: so.progress}
+	}
+	if size < 0 || size > payloadMaxSize {
+		var u string
+		if _, err := cli.GetData(cli.scanURL("files/upload_url"), &u); err != nil {
+			return nil, err
+		}
+		var err error
+		if uploadURL, err = url.Parse(u); err != nil {
+			return nil, err
+		}
+	}
+
+	// The multipart body is written into a pipe by a separate goroutine while
+	// the request reads from the other end. Closing the reader when the
+	// request finishes unblocks the goroutine if the request failed before
+	// reading the whole body.
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	w := multipart.NewWriter(pw)
+	go func() {
+		f, err := w.CreateFormFile("file", filename)
+		if err == nil {
+			_, err = io.Copy(f, r)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	o := opts(WithHeader("Content-Type", w.FormDataContentType()))
+	apiResp, err := cli.doRequest(context.Background(), "POST", uploadURL, pr, o)
+	if err != nil {
+		return nil, err
+	}
+	analysis := &Object{}
+	if err := json.Unmarshal(apiResp.Data, analysis); err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
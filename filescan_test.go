@@ -0,0 +1,157 @@
+package vt
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFileIDFromReader(t *testing.T) {
+	tests := map[string]string{
+		"":      "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"hello": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	}
+	for content, expected := range tests {
+		id, err := FileIDFromReader(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != expected {
+			t.Errorf("FileIDFromReader(%q) = %s, expecting %s", content, id, expected)
+		}
+	}
+}
+
+func TestLookupOrScan(t *testing.T) {
+	const content = "hello"
+	const id = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	var uploaded string
+	known := false
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v3/files/"+id:
+			if !known {
+				writeError(w, http.StatusNotFound, "NotFoundError")
+				return
+			}
+			writeResponse(w, http.StatusOK, map[string]interface{}{
+				"data": map[string]string{"type": "file", "id": id}})
+		case r.Method == "POST" && r.URL.Path == "/api/v3/files":
+			mr, err := r.MultipartReader()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			part, err := mr.NextPart()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			b, _ := ioutil.ReadAll(part)
+			uploaded = string(b)
+			writeResponse(w, http.StatusOK, map[string]interface{}{
+				"data": map[string]string{"type": "analysis", "id": "analysis-id"}})
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		}
+	})
+
+	obj, scanned, err := cli.LookupOrScan(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !scanned || obj.Type != "analysis" || uploaded != content {
+		t.Errorf("unknown file was not uploaded: scanned=%v type=%s uploaded=%q",
+			scanned, obj.Type, uploaded)
+	}
+
+	known, uploaded = true, ""
+	obj, scanned, err = cli.LookupOrScan(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scanned || obj.Type != "file" || obj.ID != id || uploaded != "" {
+		t.Errorf("known file was scanned again: scanned=%v type=%s id=%s",
+			scanned, obj.Type, obj.ID)
+	}
+}
+
+func TestScanFileFromReader(t *testing.T) {
+	var uploadedTo, filename, content string
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v3/files/upload_url":
+			writeResponse(w, http.StatusOK, map[string]interface{}{
+				"data": "https://" + r.Host + "/upload/1234"})
+		case r.Method == "POST":
+			mr, err := r.MultipartReader()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			part, err := mr.NextPart()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			b, _ := ioutil.ReadAll(part)
+			uploadedTo, filename, content = r.URL.Path, part.FileName(), string(b)
+			writeResponse(w, http.StatusOK, map[string]interface{}{
+				"data": map[string]string{"type": "analysis", "id": "analysis-id"}})
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		}
+	})
+
+	tests := []struct {
+		r     io.Reader
+		path  string
+		total int64
+	}{
+		// Small seekable readers are uploaded directly.
+		{strings.NewReader("hello"), "/api/v3/files", 5},
+		// Readers of unknown size are sent to an upload URL.
+		{io.MultiReader(strings.NewReader("hello")), "/upload/1234", -1},
+	}
+	for _, test := range tests {
+		var sent, total int64
+		obj, err := cli.ScanFileFromReader(test.r, "hello.txt",
+			WithUploadProgress(func(s, t int64) { sent, total = s, t }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sent != 5 || total != test.total {
+			t.Errorf("got progress %d of %d, expecting 5 of %d", sent, total, test.total)
+		}
+		if obj.Type != "analysis" || obj.ID != "analysis-id" {
+			t.Errorf("got object %s/%s, expecting analysis", obj.Type, obj.ID)
+		}
+		if uploadedTo != test.path || filename != "hello.txt" || content != "hello" {
+			t.Errorf("uploaded %q as %q to %s, expecting %s", content, filename, uploadedTo, test.path)
+		}
+	}
+}
+
+func TestRescan(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v3/files/foo/analyse" {
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]string{"type": "analysis", "id": "analysis-id"}})
+	})
+	obj, err := cli.Rescan("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Type != "analysis" || obj.ID != "analysis-id" {
+		t.Errorf("got object %s/%s, expecting analysis", obj.Type, obj.ID)
+	}
+	if _, err := cli.Rescan("bar"); !IsNotFound(err) {
+		t.Errorf("got error %v, expecting not found", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import "fmt"
+
+// GraphNode is a node in a VirusTotal Graph, which represents an entity like
+// a file, URL, domain or IP address.
+type GraphNode struct {
+	// EntityID is the entity's identifier, like a file's SHA-256 or a
+	// domain name.
+	EntityID string `json:"entity_id"`
+	// Type is the entity's type, like "file", "url", "domain" or
+	// "ip_address".
+	Type string `json:"type"`
+}
+
+// GraphLink is an edge in a VirusTotal Graph, connecting two of its nodes.
+type GraphLink struct {
+	// Source and Target are the entity IDs of the connected nodes.
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// ConnectionType describes the relationship between the nodes, which is
+	// usually the name of a relationship, like "contacted_domains".
+	ConnectionType string `json:"connection_type"`
+}
+
+// GraphData contains the nodes and links of a VirusTotal Graph, as found in
+// the graph's "graph_data" attribute.
+type GraphData struct {
+	Nodes []GraphNode `json:"nodes"`
+	Links []GraphLink `json:"links"`
+}
+
+// CreateGraph creates a VirusTotal Graph with the given name, nodes and
+// links, and returns it. Every link must connect nodes included in the graph.
+func (cli *Client) CreateGraph(name string, data *GraphData) (*Object, error) {
+	nodes := make(map[string]bool, len(data.Nodes))
+	for _, n := range data.Nodes {
+		nodes[n.EntityID] = true
+	}
+	for _, l := range data.Links {
+		if !nodes[l.Source] || !nodes[l.Target] {
+			return nil, fmt.Errorf("link from %q to %q connects nodes not in the graph", l.Source, l.Target)
+		}
+	}
+	graph := NewObject()
+	graph.Type = "graph"
+	graph.Attributes["name"] = name
+	graph.Attributes["graph_data"] = data
+	if err := cli.CreateObject(URL("graphs"), graph); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+// GetGraph returns the VirusTotal Graph with the given ID. Its nodes and links
+// can be obtained with GetGraphData.
+func (cli *Client) GetGraph(id string) (*Object, error) {
+	return cli.GetObject(URL("graphs/%s", id))
+}
+
+// Graphs returns an iterator over the VirusTotal Graphs visible to the user.
+// Use WithFilter for narrowing the graphs, for example to those owned by a
+// given user with WithFilter("owner:<username>").
+func (cli *Client) Graphs(options ...IteratorOption) (*Iterator, error) {
+	return cli.Iterator(URL("graphs"), options...)
+}
+
+// GetGraphData returns the nodes and links of a graph object, as returned
+// by Client.GetGraph or by the iterator created with Client.Graphs.
+func GetGraphData(obj *Object) (*GraphData, error) {
+	v, ok := obj.Attributes["graph_data"]
+	if !ok {
+		return nil, fmt.Errorf("object %s doesn't have graph data", obj.ID)
+	}
+	data := &GraphData{}
+	if m, ok := v.(map[string]interface{}); ok {
+		if err := unmarshalMap(m, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+	if d, ok := v.(*GraphData); ok {
+		*data = *d
+		return data, nil
+	}
+	return nil, fmt.Errorf("attribute \"graph_data\" is not a map")
+}
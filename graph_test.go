@@ -0,0 +1,89 @@
+package vt
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGraphs(t *testing.T) {
+	var created map[string]interface{}
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/v3/graphs":
+			var req struct {
+				Data struct {
+					Attributes map[string]interface{} `json:"attributes"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			created = req.Data.Attributes
+		case r.Method == "GET" && r.URL.Path == "/api/v3/graphs/g1234":
+		case r.Method == "GET" && r.URL.Path == "/api/v3/graphs":
+			writeResponse(w, http.StatusOK, map[string]interface{}{
+				"data": []interface{}{map[string]interface{}{
+					"type": "graph", "id": "g1234", "attributes": created}}})
+			return
+		default:
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{"type": "graph", "id": "g1234", "attributes": created}})
+	})
+
+	data := &GraphData{
+		Nodes: []GraphNode{
+			{EntityID: "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f", Type: "file"},
+			{EntityID: "example.com", Type: "domain"},
+		},
+		Links: []GraphLink{{
+			Source:         "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f",
+			Target:         "example.com",
+			ConnectionType: "contacted_domains",
+		}},
+	}
+	graph, err := cli.CreateGraph("investigation", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := graph.GetAttributeString("name"); graph.ID != "g1234" || name != "investigation" {
+		t.Errorf("got graph %s named %q", graph.ID, name)
+	}
+
+	graph, err = cli.GetGraph("g1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := GetGraphData(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("got graph data %+v, expecting %+v", got, data)
+	}
+
+	it, err := cli.Graphs(WithFilter("owner:foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	graphs, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graphs) != 1 || graphs[0].ID != "g1234" {
+		t.Errorf("got graphs %v", graphs)
+	}
+
+	// Links must connect nodes in the graph.
+	data.Links[0].Target = "example.org"
+	if _, err := cli.CreateGraph("invalid", data); err == nil {
+		t.Error("expecting error for link to a node not in the graph")
+	}
+	if _, err := GetGraphData(NewObject()); err == nil {
+		t.Error("expecting error for object without graph data")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+// HuntingNotification contains the information about a Livehunt hit that is
+// returned in the context attributes of each file produced by the iterator
+// returned by Client.HuntingNotifications.
+type HuntingNotification struct {
+	ID          string   `json:"notification_id"`
+	RuleName    string   `json:"rule_name"`
+	RulesetID   string   `json:"ruleset_id"`
+	RulesetName string   `json:"ruleset_name"`
+	Tags        []string `json:"tags"`
+}
+
+// HuntingNotifications returns an iterator over the files that triggered a
+// Livehunt notification, newest first. Use WithFilter for narrowing the
+// notifications, for example to those with a given tag, and
+// GetHuntingNotification for getting the notification details from each file.
+func (cli *Client) HuntingNotifications(options ...IteratorOption) (*Iterator, error) {
+	return cli.Iterator(URL("intelligence/hunting_notification_files"), options...)
+}
+
+// GetHuntingNotification returns the Livehunt notification details contained
+// in the context attributes of a file returned by the iterator created with
+// Client.HuntingNotifications.
+func GetHuntingNotification(obj *Object) (*HuntingNotification, error) {
+	n := &HuntingNotification{}
+	if err := obj.UnmarshalContextAttributes(n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// DeleteHuntingNotification deletes the Livehunt notification with the given
+// ID, as found in HuntingNotification.ID.
+func (cli *Client) DeleteHuntingNotification(id string) error {
+	return cli.DeleteObject("intelligence/hunting_notifications", id)
+}
+
+// DeleteHuntingNotifications deletes the Livehunt notifications matching the
+// given filter with a single request to the bulk delete endpoint, and returns
+// the number of deleted notifications as reported by the backend. The filter
+// has the same syntax used while iterating over the notifications with
+// WithFilter. An empty filter deletes all notifications.
+func (cli *Client) DeleteHuntingNotifications(filter string) (int, error) {
+	u := URL("intelligence/hunting_notifications")
+	if filter != "" {
+		q := u.Query()
+		q.Add("filter", filter)
+		u.RawQuery = q.Encode()
+	}
+	resp, err := cli.Delete(u)
+	if err != nil {
+		return 0, err
+	}
+	count, _ := resp.Meta["count"].(float64)
+	return int(count), nil
+}
+
+// CreateRuleset creates a Livehunt ruleset with the given name and YARA rules,
+// and returns it. If the rules are not valid the error is an Error containing
+// the message returned by the backend.
+func (cli *Client) CreateRuleset(name, yara string, enabled bool) (*Object, error) {
+	ruleset := NewObject()
+	ruleset.Type = "hunting_ruleset"
+	ruleset.Attributes["name"] = name
+	ruleset.Attributes["rules"] = yara
+	ruleset.Attributes["enabled"] = enabled
+	if err := cli.CreateObject(URL("intelligence/hunting_rulesets"), ruleset); err != nil {
+		return nil, err
+	}
+	return ruleset, nil
+}
+
+// GetRuleset returns the Livehunt ruleset with the given ID.
+func (cli *Client) GetRuleset(id string) (*Object, error) {
+	return cli.GetObject(URL("intelligence/hunting_rulesets/%s", id))
+}
+
+// UpdateRuleset replaces the YARA rules of the Livehunt ruleset with the given
+// ID and enables or disables it, returning the updated ruleset. For updating
+// other attributes, or only some of them, use GetRuleset, modify the ruleset
+// with the Object.SetAttribute* functions, and send it with PatchObject.
+func (cli *Client) UpdateRuleset(id, yara string, enabled bool) (*Object, error) {
+	ruleset := &Object{Type: "hunting_ruleset", ID: id}
+	ruleset.SetAttributeString("rules", yara)
+	ruleset.SetAttributeBool("enabled", enabled)
+	if err := cli.PatchObject(nil, ruleset); err != nil {
+		return nil, err
+	}
+	return ruleset, nil
+}
+
+// DeleteRuleset deletes the Livehunt ruleset with the given ID.
+func (cli *Client) DeleteRuleset(id string) error {
+	return cli.DeleteObject("intelligence/hunting_rulesets", id)
+}
+
+// Rulesets returns an iterator over the user's Livehunt rulesets.
+func (cli *Client) Rulesets(options ...IteratorOption) (*Iterator, error) {
+	return cli.Iterator(URL("intelligence/hunting_rulesets"), options...)
+}
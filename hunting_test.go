@@ -0,0 +1,178 @@
+package vt
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDeleteHuntingNotifications(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Path != "/api/v3/intelligence/hunting_notifications" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		if f := r.URL.Query().Get("filter"); f != "tag:foo" {
+			t.Errorf("unexpected filter: %q", f)
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"meta": map[string]interface{}{"count": 42}})
+	})
+	n, err := cli.DeleteHuntingNotifications("tag:foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 42 {
+		t.Errorf("got %d deleted notifications, expecting 42", n)
+	}
+}
+
+func TestRulesets(t *testing.T) {
+	rulesets := map[string]map[string]interface{}{}
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Data struct {
+				Attributes map[string]interface{} `json:"attributes"`
+			} `json:"data"`
+		}
+		if r.Method == "POST" || r.Method == "PATCH" {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			if rules, _ := req.Data.Attributes["rules"].(string); strings.Contains(rules, "syntax error") {
+				writeResponse(w, http.StatusUnprocessableEntity, map[string]interface{}{
+					"error": map[string]string{"code": "InvalidArgumentError", "message": "line 1: syntax error"}})
+				return
+			}
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/v3/intelligence/hunting_rulesets/")
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/v3/intelligence/hunting_rulesets":
+			id = "1234"
+			rulesets[id] = req.Data.Attributes
+		case r.Method == "PATCH" && rulesets[id] != nil:
+			for k, v := range req.Data.Attributes {
+				rulesets[id][k] = v
+			}
+		case r.Method == "DELETE" && rulesets[id] != nil:
+			delete(rulesets, id)
+			w.WriteHeader(http.StatusOK)
+			return
+		case r.Method == "GET" && r.URL.Path == "/api/v3/intelligence/hunting_rulesets":
+			var data []interface{}
+			for id, attrs := range rulesets {
+				data = append(data, map[string]interface{}{"type": "hunting_ruleset", "id": id, "attributes": attrs})
+			}
+			writeResponse(w, http.StatusOK, map[string]interface{}{"data": data})
+			return
+		case r.Method == "GET" && rulesets[id] != nil:
+		default:
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{"type": "hunting_ruleset", "id": id, "attributes": rulesets[id]}})
+	})
+
+	ruleset, err := cli.CreateRuleset("test", "rule foo { condition: true }", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := ruleset.GetAttributeString("name"); ruleset.ID != "1234" || name != "test" {
+		t.Errorf("got ruleset %s named %q", ruleset.ID, name)
+	}
+
+	_, err = cli.CreateRuleset("test", "rule foo { syntax error }", true)
+	if apiErr, ok := err.(Error); !ok || apiErr.HTTPStatus != http.StatusUnprocessableEntity ||
+		apiErr.Message != "line 1: syntax error" {
+		t.Errorf("got error %#v", err)
+	}
+
+	if _, err := cli.UpdateRuleset("1234", "rule bar { condition: false }", false); err != nil {
+		t.Fatal(err)
+	}
+	ruleset, err = cli.GetRuleset("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, _ := ruleset.GetAttributeString("rules")
+	enabled, _ := ruleset.GetAttributeBool("enabled")
+	name, _ := ruleset.GetAttributeString("name")
+	if rules != "rule bar { condition: false }" || enabled || name != "test" {
+		t.Errorf("got ruleset with rules %q, enabled %v and name %q", rules, enabled, name)
+	}
+
+	it, err := cli.Rulesets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].ID != "1234" {
+		t.Errorf("got rulesets %v", all)
+	}
+
+	if err := cli.DeleteRuleset("1234"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.GetRuleset("1234"); !IsNotFound(err) {
+		t.Errorf("got error %v for deleted ruleset", err)
+	}
+}
+
+func TestHuntingNotifications(t *testing.T) {
+	var deleted string
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v3/intelligence/hunting_notification_files":
+			if f := r.URL.Query().Get("filter"); f != "tag:foo" {
+				t.Errorf("unexpected filter: %q", f)
+			}
+			writeResponse(w, http.StatusOK, map[string]interface{}{
+				"data": []interface{}{
+					map[string]interface{}{
+						"type": "file", "id": "abcd",
+						"context_attributes": map[string]interface{}{
+							"notification_id": "1234",
+							"rule_name":       "foo_rule",
+							"ruleset_id":      "5678",
+							"ruleset_name":    "foo",
+							"tags":            []string{"foo", "foo_rule"},
+						}}}})
+		case r.Method == "DELETE" && r.URL.Path == "/api/v3/intelligence/hunting_notifications/1234":
+			deleted = "1234"
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		}
+	})
+
+	it, err := cli.HuntingNotifications(WithFilter("tag:foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].ID != "abcd" {
+		t.Fatalf("got files %v", files)
+	}
+	n, err := GetHuntingNotification(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.ID != "1234" || n.RuleName != "foo_rule" || n.RulesetName != "foo" ||
+		len(n.Tags) != 2 || n.Tags[0] != "foo" {
+		t.Errorf("unexpected notification: %+v", n)
+	}
+
+	if err := cli.DeleteHuntingNotification(n.ID); err != nil {
+		t.Fatal(err)
+	}
+	if deleted != "1234" {
+		t.Errorf("notification was not deleted")
+	}
+}
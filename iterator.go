@@ -16,10 +16,17 @@ package vt
 import (
 	"bytes"
 	"compress/flate"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -58,6 +65,30 @@ func (c *cursor) decode(s string) error {
 type collectionObject struct {
 	object *Object
 	cursor cursor
+	// serverCursor is the cursor returned by the backend that must be used
+	// for resuming the iteration after this object, see WithServerCursor.
+	serverCursor string
+	// raw is the object's JSON as returned by the backend, only for iterators
+	// created with WithRawJSON(true).
+	raw json.RawMessage
+}
+
+// encodeCursor returns the cursor that must be returned by Iterator.Cursor
+// for this object, which is the backend's cursor if server is true.
+func (co *collectionObject) encodeCursor(server bool) string {
+	if server {
+		return co.serverCursor
+	}
+	return co.cursor.encode()
+}
+
+// page contains the objects retrieved from the backend in a single request.
+type page struct {
+	objects []collectionObject
+	// last is true if this is the last page in the collection.
+	last bool
+	// meta is the metadata returned by the backend with the page.
+	meta map[string]interface{}
 }
 
 // IteratorOption represents an option passed to an iterator.
@@ -71,6 +102,52 @@ func WithCursor(cursor string) IteratorOption {
 	}
 }
 
+// WithServerCursor receives a boolean that indicates whether or not Cursor
+// returns the cursors generated by the backend, which are found in the "cursor"
+// field of the collection's metadata, instead of the cursors generated by this
+// package. Cursors passed to WithCursor and Seek are then sent to the backend
+// as is. The backend's cursors are understood by other VirusTotal clients,
+// like vt-py, which is useful for teams sharing iteration state between
+// programs written in different languages. However, they identify a page of
+// objects instead of a single object, so resuming the iteration from a
+// cursor obtained in the middle of a page returns again the objects of that
+// page that were already returned. The cursor obtained for the last object in
+// a page is exact. Collections that don't return cursors in their metadata
+// can't be resumed with this option.
+func WithServerCursor(b bool) IteratorOption {
+	return func(it *Iterator) {
+		it.serverCursor = b
+	}
+}
+
+// reservedParams are the query parameters set by iterators or by other
+// iterator options, which can't be set with WithParam.
+var reservedParams = map[string]bool{
+	"limit":            true,
+	"filter":           true,
+	"order":            true,
+	"descriptors_only": true,
+	"attributes":       true,
+	"cursor":           true,
+}
+
+// WithParam specifies a query parameter to be included in the request for the
+// collection's first page, like the parameters supported by some collections
+// that don't have a dedicated option. The backend usually keeps the parameters
+// in the links to the following pages. Parameters that are set by other
+// options, like "filter" or "limit", or by the iterator itself, like "cursor",
+// can't be set with WithParam and creating the iterator fails with an error
+// if that's attempted, use the dedicated option instead. Parameters already
+// present in the collection's URL are replaced.
+func WithParam(key, value string) IteratorOption {
+	return func(it *Iterator) {
+		if it.params == nil {
+			it.params = make(map[string]string)
+		}
+		it.params[key] = value
+	}
+}
+
 // WithFilter specifies a filtering query that is sent to the backend. The
 // backend will return items that comply with the condition imposed by the
 // filter. The filter syntax varies depending on the collection being iterated.
@@ -80,11 +157,58 @@ func WithFilter(filter string) IteratorOption {
 	}
 }
 
+// WithOrder specifies the order in which the backend returns the objects, for
+// collections that support ordering. The order is the name of a field (i.e:
+// "last_submission_date"), optionally followed by "+" for ascending order or
+// "-" for descending order. The option is ignored when resuming an iteration
+// with WithCursor, as the cursor already determines the order.
+func WithOrder(order string) IteratorOption {
+	return func(it *Iterator) {
+		it.order = order
+	}
+}
+
 // WithBatchSize specifies the number of items that are retrieved in a single
-// call to the backend.
+// call to the backend, which must be positive. Each collection has its own
+// maximum, most collections, like relationships, comments or Livehunt
+// notifications, accept up to 40 objects per call, while others, like
+// Intelligence searches, accept more. Batch sizes larger than the maximum
+// are rejected by the backend, see WithClampBatchSize.
 func WithBatchSize(n int) IteratorOption {
 	return func(it *Iterator) {
 		it.batchSize = n
+		it.batchSizeSet = true
+	}
+}
+
+// safeBatchSize is the batch size accepted by most collections, which is used
+// when the backend rejects a larger one, see WithClampBatchSize.
+const safeBatchSize = 40
+
+// WithClampBatchSize receives a boolean that indicates whether or not the
+// iterator must reduce the batch size set with WithBatchSize to 40, which is
+// accepted by most collections, when the backend rejects it for being too
+// large, and request the page again. Otherwise the iteration stops with an
+// error. The default is false.
+func WithClampBatchSize(b bool) IteratorOption {
+	return func(it *Iterator) {
+		it.clampBatchSize = b
+	}
+}
+
+// WithSkip specifies a number of objects at the beginning of the collection
+// that are discarded before the iterator starts returning objects, which
+// allows resuming an iteration when only the number of objects already
+// processed is known, instead of a cursor. The skipped objects are requested
+// as descriptors only, in pages of 40, so skipping many objects is cheaper
+// than iterating over them, but it still costs a request per page, as the
+// backend has no way of jumping to a given position. Skipped objects are
+// counted before applying WithPredicate, and they don't count towards the
+// limit set with WithLimit. This option can't be used together with
+// WithCursor.
+func WithSkip(n int) IteratorOption {
+	return func(it *Iterator) {
+		it.skipObjects = n
 	}
 }
 
@@ -104,64 +228,477 @@ func WithDescriptorsOnly(b bool) IteratorOption {
 	}
 }
 
+// WithAttributes specifies the attributes that the backend should include in
+// the returned objects, instead of all of them. Not all collections support
+// selecting attributes, those that don't return the full objects. This option
+// can't be used together with WithDescriptorsOnly.
+func WithAttributes(attrs []string) IteratorOption {
+	return func(it *Iterator) {
+		it.attributes = attrs
+	}
+}
+
+// WithPredicate specifies a function that is applied client-side to every
+// object returned by the backend. Objects for which the function returns false
+// are discarded and don't count against the limit set with WithLimit. When
+// used more than once an object must satisfy all the predicates.
+func WithPredicate(fn func(*Object) bool) IteratorOption {
+	return func(it *Iterator) {
+		if prev := it.predicate; prev != nil {
+			it.predicate = func(obj *Object) bool { return prev(obj) && fn(obj) }
+		} else {
+			it.predicate = fn
+		}
+	}
+}
+
+// WithMinMalicious discards objects with less than n engines flagging them as
+// malicious in their last analysis. Objects without a "last_analysis_stats"
+// attribute are discarded too. The filtering is done client-side, see
+// WithPredicate.
+func WithMinMalicious(n int) IteratorOption {
+	return WithPredicate(func(obj *Object) bool {
+		malicious, err := obj.MaliciousCount()
+		return err == nil && malicious >= n
+	})
+}
+
+// WithHeartbeat specifies a function that is called every interval while the
+// iterator is waiting for the backend to return more objects. This allows
+// distinguishing between an iterator that is stalled and one that is alive
+// but not receiving new objects. The function is called from a goroutine that
+// is started for every request and stopped when the response arrives, even
+// for synchronous iterators, so it must be safe to call it concurrently with
+// the code using the iterator. Closing the iterator stops the heartbeats, but
+// a call that was about to start when the iterator was closed may still
+// happen right after Close returns.
+func WithHeartbeat(interval time.Duration, fn func()) IteratorOption {
+	return func(it *Iterator) {
+		it.heartbeatInterval = interval
+		it.heartbeat = fn
+	}
+}
+
+// WithSynchronous receives a boolean that indicates whether or not the iterator
+// must retrieve objects from the backend synchronously. By default iterators
+// use a background goroutine that retrieves objects while the current ones
+// are being processed. Synchronous iterators don't use a background
+// goroutine, instead Next retrieves a new batch of objects when the previous
+// one is exhausted. This means that there's no prefetching and the caller
+// waits for every request to the backend, but the iterator's lifecycle is
+// simpler: nothing runs in the background between calls to Next and
+// forgetting to call Close doesn't leak anything. The only goroutine used is
+// the one calling the function set with WithHeartbeat while Next waits for a
+// response.
+func WithSynchronous(b bool) IteratorOption {
+	return func(it *Iterator) {
+		it.synchronous = b
+	}
+}
+
+// WithEagerFirstPage receives a boolean that indicates whether or not the
+// first page of objects must be retrieved before returning the iterator. When
+// true, errors that occur while retrieving the first page (i.e: an invalid URL
+// or API key) are returned by the function that creates the iterator instead
+// of by Error after the first call to Next.
+func WithEagerFirstPage(b bool) IteratorOption {
+	return func(it *Iterator) {
+		it.eagerFirstPage = b
+	}
+}
+
+// WithContext specifies a context for the iterator. When the context is
+// cancelled any in-flight request to the backend is aborted, Next returns
+// false and Error returns the context's error.
+func WithContext(ctx context.Context) IteratorOption {
+	return func(it *Iterator) {
+		it.ctx = ctx
+	}
+}
+
+// WithPrefetch specifies the number of pages that the iterator can retrieve
+// from the backend ahead of the page whose objects are being returned by
+// Next. By default the iterator doesn't retrieve a page until all objects in
+// the previous one have been sent to the iterator's internal buffer, which
+// means that the caller may be waiting for the backend every time a page is
+// exhausted. With prefetching the next pages are retrieved while the caller
+// is still processing the current one. Objects are still returned in the same
+// order and with valid cursors. This option is ignored by synchronous
+// iterators.
+func WithPrefetch(n int) IteratorOption {
+	return func(it *Iterator) {
+		it.prefetch = n
+	}
+}
+
+// defaultChannelBuffer is the size of the iterator's internal buffer when
+// WithChannelBuffer is not used.
+const defaultChannelBuffer = 50
+
+// WithChannelBuffer specifies the number of objects that the goroutine
+// retrieving pages can send to the iterator's internal buffer before the
+// caller consumes them with Next, which must be at least 1. Larger buffers
+// allow the goroutine to run further ahead of the caller, at the cost of
+// keeping more objects in memory. The default is 50. This option is ignored by
+// synchronous iterators.
+func WithChannelBuffer(n int) IteratorOption {
+	return func(it *Iterator) {
+		it.channelBuffer = n
+	}
+}
+
+// WithProgress specifies a function that is called after retrieving each page
+// of objects from the backend. The function receives the number of objects
+// retrieved so far and the total number of objects in the collection, as
+// reported by the backend in the "count" field of the collection's metadata.
+// If the backend doesn't report the total, total is -1. The function is called
+// from the goroutine that retrieves the objects and it should return quickly,
+// as it's blocking the iteration.
+func WithProgress(fn func(done, total int)) IteratorOption {
+	return func(it *Iterator) {
+		it.progress = fn
+	}
+}
+
+// WithRawJSON receives a boolean that indicates whether or not the iterator
+// must keep the JSON returned by the backend for each object, which can be
+// obtained with Raw. This is useful for storing the objects exactly as they
+// were returned by the backend.
+func WithRawJSON(b bool) IteratorOption {
+	return func(it *Iterator) {
+		it.rawJSON = b
+	}
+}
+
+// WithSkipMalformed receives a boolean that indicates whether or not objects
+// that can't be decoded, like those having attributes with an unexpected type,
+// are skipped instead of stopping the iteration with an error. Skipped objects
+// are reported by Errors, but not by Error. By default malformed objects stop
+// the iteration.
+func WithSkipMalformed(b bool) IteratorOption {
+	return func(it *Iterator) {
+		it.skipMalformed = b
+	}
+}
+
+// MetricsSink receives the durations measured by iterators created with
+// WithMetrics, identified by the names below. Its methods may be called
+// concurrently from the iterator's goroutine and the one calling Next.
+type MetricsSink interface {
+	ObserveDuration(name string, d time.Duration)
+}
+
+// Names of the durations observed by iterators created with WithMetrics.
+const (
+	// IteratorFetchMetric is the time spent retrieving a page of objects
+	// from the backend, observed once per request, including failed ones.
+	IteratorFetchMetric = "iterator_fetch"
+	// IteratorSendWaitMetric is the time that the iterator's goroutine
+	// spent waiting for the consumer before it could hand over an object or
+	// an error, observed once per item. It's not observed by synchronous
+	// iterators.
+	IteratorSendWaitMetric = "iterator_send_wait"
+	// IteratorNextWaitMetric is the time that the consumer spent in Next
+	// waiting for an object, observed once per object delivered, so the
+	// number of observations is the number of objects delivered.
+	IteratorNextWaitMetric = "iterator_next_wait"
+)
+
+// WithMetrics specifies a sink that receives the durations of the iterator's
+// internal operations, which helps tuning options like WithBatchSize and
+// WithPrefetch. Comparing IteratorSendWaitMetric with IteratorNextWaitMetric
+// shows whether the consumer is waiting for the backend or the other way
+// around. Nothing is measured if the sink is nil, which is the default.
+func WithMetrics(sink MetricsSink) IteratorOption {
+	return func(it *Iterator) {
+		it.metrics = sink
+	}
+}
+
+// observeSince reports the time elapsed since start to the iterator's metrics
+// sink, which must not be nil.
+func (it *Iterator) observeSince(name string, start time.Time) {
+	it.metrics.ObserveDuration(name, time.Since(start))
+}
+
+// WithMaxRetries specifies the maximum number of times that the request for a
+// page is retried when it fails with a transient error, or when it's rejected
+// because the rate limit was exceeded (HTTP 429). If the server indicates how
+// long to wait with a Retry-After header the iterator waits for that long
+// before retrying, otherwise it uses an exponential backoff. The error is
+// returned by Error only after exceeding the maximum number of retries. The
+// default is 3, and 0 disables retries.
+func WithMaxRetries(n int) IteratorOption {
+	return func(it *Iterator) {
+		it.maxRetries = n
+	}
+}
+
+// WithPageTimeout specifies a timeout for each of the requests sent for
+// retrieving pages of objects, overriding the client's default timeout set
+// with WithTimeout. This is useful for slow collections, like the results of
+// complex searches.
+func WithPageTimeout(d time.Duration) IteratorOption {
+	return func(it *Iterator) {
+		it.pageTimeout = d
+	}
+}
+
 // Iterator represents a iterator over a collection of VirusTotal objects.
 type Iterator struct {
-	client          *Client
-	ch              chan interface{}
-	done            chan bool
-	next            *Object
-	err             error
-	closed          bool
-	limit           int
-	count           int
-	batchSize       int
-	filter          string
-	cursor          string
-	descriptorsOnly bool
-	links           Links
-	meta            map[string]interface{}
+	client            *Client
+	ctx               context.Context
+	ch                chan interface{}
+	next              *Object
+	raw               json.RawMessage
+	err               error
+	limit             int
+	count             int
+	batchSize         int
+	batchSizeSet      bool
+	skipObjects       int
+	clampBatchSize    bool
+	filter            string
+	order             string
+	cursor            string
+	descriptorsOnly   bool
+	attributes        []string
+	params            map[string]string
+	predicate         func(*Object) bool
+	heartbeat         func()
+	heartbeatInterval time.Duration
+	synchronous       bool
+	eagerFirstPage    bool
+	prefetch          int
+	serverCursor      bool
+	channelBuffer     int
+	progress          func(done, total int)
+	rawJSON           bool
+	skipMalformed     bool
+	metrics           MetricsSink
+	maxRetries        int
+	retryBackoff      time.Duration
+	pageTimeout       time.Duration
+	links             Links
+	// firstURL is the URL of the collection's first page, it's empty if the
+	// iterator was created with a cursor.
+	firstURL string
+	// mu protects meta and errs, which are updated by the goroutine that
+	// retrieves the objects, and closed, which is set by Close.
+	mu   sync.Mutex
+	meta map[string]interface{}
+	// errs contains the most recent errors occurred during the iteration,
+	// see Errors.
+	errs []error
+	// Fields used only by synchronous iterators. pending contains the objects
+	// retrieved from the backend that haven't been returned yet, skip is the
+	// number of objects to skip in the next batch and exhausted is true when
+	// there are no more batches to retrieve.
+	pending   []collectionObject
+	skip      int
+	exhausted bool
+	// completed is true once Next returned false because the collection was
+	// fully consumed, see Completed. finished is set by the goroutine that
+	// retrieves the objects before closing ch if it sent every object in the
+	// collection, and closed is set by Close, see isClosed.
+	completed bool
+	finished  bool
+	closed    bool
+	// toSkip is the number of objects at the beginning of the collection
+	// that haven't been skipped yet, see WithSkip.
+	toSkip int
+	// pendingErr is an error that occurred while retrieving a page in
+	// HasNext, which is returned by the next call to Next.
+	pendingErr error
+	// peeked is true if HasNext received an item from ch that hasn't been
+	// returned by Next yet, peekedItem and peekedOK are the results of
+	// receiving from the channel.
+	peeked     bool
+	peekedItem interface{}
+	peekedOK   bool
+	// fetchCtx is derived from ctx, and is used for requests sent to the
+	// backend and for stopping the goroutine that retrieves objects, if any.
+	// It's cancelled when the iterator is closed.
+	fetchCtx context.Context
+	cancel   context.CancelFunc
 }
 
 func newIterator(cli *Client, u *url.URL, options ...IteratorOption) (*Iterator, error) {
 
-	skip := 0
 	it := &Iterator{
-		client: cli,
-		ch:     make(chan interface{}, 50),
-		done:   make(chan bool)}
+		client:        cli,
+		ctx:           context.Background(),
+		maxRetries:    defaultMaxPageRetries,
+		retryBackoff:  pageRetryBackoff,
+		channelBuffer: defaultChannelBuffer}
 
 	for _, opt := range options {
 		opt(it)
 	}
 
-	if it.cursor != "" {
-		c := cursor{}
-		err := c.decode(it.cursor)
-		if err != nil {
-			return nil, err
+	if it.descriptorsOnly && len(it.attributes) > 0 {
+		return nil, fmt.Errorf("WithAttributes and WithDescriptorsOnly can't be used together")
+	}
+
+	if it.skipObjects < 0 {
+		return nil, fmt.Errorf("invalid number of objects to skip %d", it.skipObjects)
+	}
+
+	if it.skipObjects > 0 && it.cursor != "" {
+		return nil, fmt.Errorf("WithSkip and WithCursor can't be used together")
+	}
+
+	if it.batchSizeSet && it.batchSize <= 0 {
+		return nil, fmt.Errorf("invalid batch size %d, must be positive", it.batchSize)
+	}
+
+	if it.channelBuffer < 1 {
+		return nil, fmt.Errorf("invalid channel buffer size %d, must be at least 1", it.channelBuffer)
+	}
+
+	for k := range it.params {
+		if reservedParams[k] {
+			return nil, fmt.Errorf("parameter %q can't be set with WithParam, use the option for it instead", k)
 		}
-		it.links.Next = c.Link
-		skip = c.Offset
-	} else {
+	}
+
+	if it.cursor == "" || it.serverCursor {
 		q := u.Query()
+		for k, v := range it.params {
+			q.Set(k, v)
+		}
 		if it.batchSize > 0 {
 			q.Add("limit", strconv.Itoa(it.batchSize))
 		}
 		if it.filter != "" {
 			q.Add("filter", it.filter)
 		}
+		if it.order != "" {
+			q.Add("order", it.order)
+		}
 		if it.descriptorsOnly {
 			q.Add("descriptors_only", "true")
 		}
+		if len(it.attributes) > 0 {
+			q.Add("attributes", strings.Join(it.attributes, ","))
+		}
 		u.RawQuery = q.Encode()
-		it.links.Next = u.String()
+		it.firstURL = u.String()
 	}
 
-	go it.iterate(skip)
-
+	if err := it.start(it.cursor); err != nil {
+		return nil, err
+	}
 	return it, nil
 }
 
+// start starts the iteration at the position indicated by the given cursor,
+// or at the beginning of the collection if the cursor is empty.
+func (it *Iterator) start(cur string) error {
+	skip := 0
+	c := cursor{}
+	if it.serverCursor {
+		// The server's cursor is sent along with the collection's first
+		// page URL and the remaining parameters.
+		if cur != "" {
+			u, err := url.Parse(it.firstURL)
+			if err != nil {
+				return err
+			}
+			q := u.Query()
+			q.Set("cursor", cur)
+			u.RawQuery = q.Encode()
+			c.Link = u.String()
+		}
+	} else if err := c.decode(cur); err != nil {
+		return err
+	}
+	if c.Link != "" {
+		it.links.Next = c.Link
+		skip = c.Offset
+		it.toSkip = 0
+	} else {
+		it.links.Next = it.firstURL
+		it.toSkip = it.skipObjects
+	}
+
+	it.fetchCtx, it.cancel = context.WithCancel(it.ctx)
+
+	var first *page
+	if it.eagerFirstPage {
+		p, err := it.nextPage(skip)
+		if err != nil {
+			it.cancel()
+			return err
+		}
+		first, skip = p, 0
+	}
+
+	if it.synchronous {
+		it.skip = skip
+		if first != nil {
+			it.pending = first.objects
+			it.exhausted = first.last
+		}
+		return nil
+	}
+
+	it.ch = make(chan interface{}, it.channelBuffer)
+	go it.iterate(skip, first)
+	return nil
+}
+
+// Seek moves the iterator to the position indicated by a cursor returned by
+// Cursor, so that the next call to Next returns the object following the one
+// that was current when the cursor was obtained. The iterator is restarted
+// from that position as if it were a new iterator with the same options,
+// which means that the objects already returned don't count towards the limit
+// set with WithLimit. Seek works even if the iterator was exhausted or closed,
+// but it must not be called concurrently with other methods.
+func (it *Iterator) Seek(cursor string) error {
+	if cursor == "" && it.firstURL == "" {
+		return fmt.Errorf("iterator created with a cursor can't be reset")
+	}
+	it.stop()
+	it.next = nil
+	it.raw = nil
+	it.err = nil
+	it.count = 0
+	it.completed = false
+	it.finished = false
+	it.mu.Lock()
+	it.closed = false
+	it.mu.Unlock()
+	it.cursor = cursor
+	it.links = Links{}
+	it.mu.Lock()
+	it.meta = nil
+	it.mu.Unlock()
+	it.pending = nil
+	it.pendingErr = nil
+	it.skip = 0
+	it.exhausted = false
+	it.peeked = false
+	it.peekedItem = nil
+	return it.start(cursor)
+}
+
+// Reset moves the iterator to the beginning of the collection, see Seek.
+func (it *Iterator) Reset() error {
+	return it.Seek("")
+}
+
+// stop stops the goroutine retrieving objects, if any, and waits until it
+// finishes.
+func (it *Iterator) stop() {
+	it.cancel()
+	if it.ch != nil {
+		for range it.ch {
+		}
+		it.ch = nil
+	}
+}
+
 // Iterator returns an iterator for a collection. Iterators are usually
 // used like this:
 //
@@ -183,139 +720,983 @@ func (cli *Client) Iterator(url *url.URL, options ...IteratorOption) (*Iterator,
 	return newIterator(cli, url, options...)
 }
 
+// RelationshipIterator returns an iterator for the objects related to obj
+// through the given relationship, like the resolutions of a domain or the
+// domains contacted by a file. The URL of the relationship is derived from
+// the object's type and ID, which must not be empty. It accepts the same
+// options as Iterator.
+func (cli *Client) RelationshipIterator(obj *Object, relationship string, options ...IteratorOption) (*Iterator, error) {
+	collection, err := objectCollection(obj)
+	if err != nil {
+		return nil, err
+	}
+	return newIterator(cli, RelationshipURL(collection, obj.ID, relationship), options...)
+}
+
 // Next advances the iterator to the next object and returns true if there are
 // more objects or false if the end of the collection has been reached.
-func (it *Iterator) Next() bool {
+func (it *Iterator) Next() (more bool) {
+	if it.metrics != nil {
+		defer func(start time.Time) {
+			if more {
+				it.observeSince(IteratorNextWaitMetric, start)
+			}
+		}(time.Now())
+	}
 	if it.limit > 0 && it.count == it.limit {
+		it.completed = true
 		return false
 	}
-	item, ok := <-it.ch
+	// Objects already retrieved are not returned once the iterator is
+	// closed. The fetching context can't be used for this, as it's also
+	// cancelled when the collection is exhausted.
+	if it.isClosed() {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.setError(err)
+		return false
+	}
+	if it.synchronous {
+		return it.nextSync()
+	}
+	item, ok := it.receive()
+	if !ok && it.ctx.Err() != nil {
+		it.setError(it.ctx.Err())
+	}
+	if !ok && it.err == nil {
+		it.completed = it.finished && !it.isClosed()
+	}
 	if ok {
 		switch v := item.(type) {
 		case collectionObject:
 			it.next = v.object
-			it.cursor = v.cursor.encode()
+			it.raw = v.raw
+			it.cursor = v.encodeCursor(it.serverCursor)
 			it.count++
 		case error:
-			it.next = nil
-			it.err = v
+			it.setError(v)
 		}
 	}
 	return ok && it.next != nil
 }
 
+// receive returns the next item sent by the goroutine retrieving objects, or
+// the item already received by HasNext, if any.
+func (it *Iterator) receive() (interface{}, bool) {
+	if it.peeked {
+		it.peeked = false
+		return it.peekedItem, it.peekedOK
+	}
+	item, ok := <-it.ch
+	return item, ok
+}
+
+// HasNext returns true if a call to Next would advance the iterator to another
+// object, without actually advancing it. This may require retrieving the next
+// page from the backend, in which case HasNext blocks until it's retrieved. If
+// retrieving the page fails HasNext returns false, and the error is returned
+// by Error after calling Next.
+func (it *Iterator) HasNext() bool {
+	if it.limit > 0 && it.count == it.limit || it.isClosed() {
+		return false
+	}
+	if it.ctx.Err() != nil {
+		return false
+	}
+	if it.synchronous {
+		if len(it.pending) == 0 && it.pendingErr == nil {
+			it.pendingErr = it.fillPending()
+		}
+		return len(it.pending) > 0
+	}
+	if !it.peeked {
+		it.peekedItem, it.peekedOK = <-it.ch
+		it.peeked = true
+	}
+	_, isObject := it.peekedItem.(collectionObject)
+	return it.peekedOK && isObject
+}
+
+// setError sets the iterator's error. If the iterator's context was cancelled
+// the error is the context's error, as any other error is probably caused by
+// the cancellation.
+func (it *Iterator) setError(err error) {
+	if ctxErr := it.ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	it.next = nil
+	it.raw = nil
+	it.err = err
+	it.addError(err)
+}
+
+// addError appends err to the errors returned by Errors, discarding the
+// oldest one if there are already maxIteratorErrors.
+func (it *Iterator) addError(err error) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if len(it.errs) == maxIteratorErrors {
+		it.errs = append(it.errs[:0], it.errs[1:]...)
+	}
+	it.errs = append(it.errs, err)
+}
+
+// nextSync is the implementation of Next for synchronous iterators.
+func (it *Iterator) nextSync() bool {
+	err := it.pendingErr
+	it.pendingErr = nil
+	if len(it.pending) == 0 && err == nil {
+		err = it.fillPending()
+	}
+	if err != nil {
+		it.setError(err)
+		return false
+	}
+	if len(it.pending) == 0 {
+		it.completed = it.exhausted && !it.isClosed()
+		return false
+	}
+	co := it.pending[0]
+	it.pending = it.pending[1:]
+	it.next = co.object
+	it.raw = co.raw
+	it.cursor = co.encodeCursor(it.serverCursor)
+	it.count++
+	return true
+}
+
+// fillPending retrieves pages from the backend until there are pending
+// objects or there are no more pages to retrieve.
+func (it *Iterator) fillPending() error {
+	for len(it.pending) == 0 {
+		if it.exhausted || it.fetchCtx.Err() != nil {
+			return nil
+		}
+		p, err := it.nextPage(it.skip)
+		if err != nil {
+			it.exhausted = true
+			return err
+		}
+		it.pending = p.objects
+		it.exhausted = p.last
+		it.skip = 0
+		it.reportProgress(it.count+len(it.pending), p)
+	}
+	return nil
+}
+
 // Get returns the current object in the collection iterator.
 func (it *Iterator) Get() *Object {
 	return it.next
 }
 
+// Descriptor returns the descriptor of the current object, which contains
+// only its type, ID and context attributes. This is useful with iterators
+// created with WithDescriptorsOnly(true), where the objects returned by the
+// backend don't have any other data. It returns a zero ObjectDescriptor if
+// there's no current object.
+func (it *Iterator) Descriptor() ObjectDescriptor {
+	if it.next == nil {
+		return ObjectDescriptor{}
+	}
+	return ObjectDescriptor{
+		ID:                it.next.ID,
+		Type:              it.next.Type,
+		ContextAttributes: it.next.ContextAttributes,
+	}
+}
+
+// Raw returns the JSON returned by the backend for the current object, or nil
+// if the iterator wasn't created with WithRawJSON(true).
+func (it *Iterator) Raw() []byte {
+	return it.raw
+}
+
 // Cursor returns a token indicating the current iterator's position.
 func (it *Iterator) Cursor() string {
 	return it.cursor
 }
 
-// Close closes a collection iterator.
+// Close closes a collection iterator. Any request to the backend that is in
+// flight is aborted, and Next returns false from then on, even if some objects
+// were already retrieved. Close never blocks, and it can be called more than once
+// and after the collection was fully iterated, which allows deferring it
+// right after creating the iterator.
 func (it *Iterator) Close() {
-	if !it.closed {
-		it.closed = true
-		it.done <- true
+	it.cancel()
+	it.mu.Lock()
+	it.closed = true
+	it.mu.Unlock()
+	if it.synchronous {
+		it.pending = nil
 	}
 }
 
+// isClosed returns true if Close was called, which can happen from another
+// goroutine.
+func (it *Iterator) isClosed() bool {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.closed
+}
+
 // Meta returns the metadata returned by the server during the last call to
 // the collection's endpoint.
 func (it *Iterator) Meta() map[string]interface{} {
+	it.mu.Lock()
+	defer it.mu.Unlock()
 	return it.meta
 }
 
+// reportProgress calls the progress function, if any, after retrieving page
+// p. done is the number of objects retrieved so far, including those in p.
+func (it *Iterator) reportProgress(done int, p *page) {
+	if it.progress == nil {
+		return
+	}
+	if it.limit > 0 && done > it.limit {
+		done = it.limit
+	}
+	total := -1
+	if count, ok := p.meta["count"].(float64); ok {
+		total = int(count)
+	}
+	it.progress(done, total)
+}
+
+// Count returns the number of objects returned by Next so far. The count
+// starts again from zero when the iterator is moved with Seek or Reset.
+func (it *Iterator) Count() int {
+	return it.count
+}
+
+// Completed returns true if the last call to Next returned false because
+// all the objects in the collection were returned, or the limit set with
+// WithLimit was reached. It returns false while there are objects left, and
+// also if the iteration stopped because of an error or because the iterator
+// was closed. Together with Count, it allows distinguishing an empty
+// collection from one that couldn't be iterated.
+func (it *Iterator) Completed() bool {
+	return it.completed
+}
+
 // Error returns any error occurred during the iteration of a collection.
 func (it *Iterator) Error() error {
 	return it.err
 }
 
+// maxIteratorErrors is the maximum number of errors returned by Errors.
+const maxIteratorErrors = 100
+
+// Errors returns the errors occurred during the iteration, oldest first,
+// including those that caused a page request to be retried and didn't stop
+// the iteration, those for objects skipped because of WithSkipMalformed, and
+// the one returned by Error, if any. Only the last 100
+// errors are kept. Errors are kept when the iterator is moved with Seek or
+// Reset, which allows monitoring the health of long running iterations. It's
+// safe to call Errors while other goroutine is calling Next.
+func (it *Iterator) Errors() []error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return append([]error(nil), it.errs...)
+}
+
+// defaultMaxPageRetries is the number of times that the request for a page is
+// retried by default, see WithMaxRetries.
+const defaultMaxPageRetries = 3
+
+// pageRetryBackoff is the time waited before retrying a failed request for a
+// page. It's doubled on every retry.
+var pageRetryBackoff = time.Second
+
+// retryDelay returns true if the request for a page that failed with err must
+// be retried, and how long to wait before doing it. backoff is the delay used
+// if the server didn't indicate one.
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	if !IsTransient(err) && !IsQuotaExceeded(err) {
+		return 0, false
+	}
+	if apiErr, ok := apiError(err); ok && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter, true
+	}
+	return backoff, true
+}
+
+// wait waits for the given duration and returns true, or returns false as soon
+// as the iterator is closed or its context is cancelled.
+func (it *Iterator) wait(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-it.fetchCtx.Done():
+		return false
+	}
+}
+
 const (
 	ok = iota
-	retry
 	stop
 )
 
-func (it *Iterator) trySendToChannel(item interface{}) int {
+// sendToChannel sends item through the iterator's channel, blocking until
+// there's room for it. It returns stop without sending the item if the
+// iterator is closed or its context cancelled in the meantime, so that the
+// goroutine retrieving objects never outlives the iterator, even if nobody is
+// reading from the channel anymore.
+func (it *Iterator) sendToChannel(item interface{}) int {
+	if it.fetchCtx.Err() != nil {
+		return stop
+	}
+	if it.metrics != nil {
+		defer it.observeSince(IteratorSendWaitMetric, time.Now())
+	}
 	select {
-	case <-it.done:
+	case <-it.fetchCtx.Done():
 		return stop
 	case it.ch <- item:
 		return ok
-	default:
-		return retry
 	}
 }
 
-func (it *Iterator) sendToChannel(item interface{}) int {
-	sent := false
-	for !sent {
-		switch it.trySendToChannel(item) {
-		case ok:
-			sent = true
-		case retry:
-			time.Sleep(10 * time.Millisecond)
-		case stop:
-			return stop
+// getMoreObjects retrieves the next page of objects from the backend. If the
+// iterator was created with WithRawJSON(true) it also returns the JSON for
+// each object, otherwise the second result is nil.
+func (it *Iterator) getMoreObjects() ([]*Object, []json.RawMessage, error) {
+	nextURL, err := url.Parse(it.links.Next)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The backend usually returns absolute links, but relative ones are
+	// resolved against the client's base URL.
+	nextURL = it.client.resolve(nextURL)
+	var objs []*Object
+	var raws []json.RawMessage
+	addObject := func(raw json.RawMessage) error {
+		obj := &Object{}
+		if err := json.Unmarshal(raw, obj); err != nil {
+			if !it.skipMalformed {
+				return err
+			}
+			it.addError(fmt.Errorf("skipping malformed object in %s: %v",
+				it.client.sanitizeURL(nextURL), err))
+			return nil
+		}
+		objs = append(objs, obj)
+		if it.rawJSON {
+			raws = append(raws, raw)
+		}
+		return nil
+	}
+	var resp *Response
+	if it.client.cache != nil || it.client.flights != nil {
+		// Cached and collapsed responses are read in memory as a whole, so
+		// they are decoded once received.
+		resp, err = it.client.GetWithContext(it.fetchCtx, nextURL,
+			WithRequestTimeout(it.pageTimeout))
+		if err != nil {
+			return nil, nil, err
 		}
+		dec := newArrayDecoder(bytes.NewReader(resp.Data))
+		for err == nil {
+			var raw json.RawMessage
+			if raw, err = dec.nextRaw(); err == nil {
+				err = addObject(raw)
+			}
+		}
+		if err != io.EOF {
+			return nil, nil, err
+		}
+	} else {
+		// Otherwise the objects are decoded as they are read, so that large
+		// pages are not kept in memory twice.
+		resp, err = it.client.getPage(it.fetchCtx, nextURL, addObject,
+			opts(WithRequestTimeout(it.pageTimeout)))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if it.rawJSON && raws == nil {
+		raws = []json.RawMessage{}
+	}
+	it.links = resp.Links
+	if it.links.Self == "" {
+		it.links.Self = nextURL.String()
+	}
+	// When the backend returns a cursor in the metadata, the next page is
+	// requested with that cursor instead of following the "next" link. The
+	// cursor identifies the position in the collection even if it changes
+	// between requests, so objects are not returned twice nor missed.
+	if c, ok := resp.Meta["cursor"].(string); ok && c != "" {
+		it.links.Self = nextURL.String()
+		q := nextURL.Query()
+		q.Set("cursor", c)
+		next := *nextURL
+		next.RawQuery = q.Encode()
+		it.links.Next = next.String()
 	}
-	return ok
+	it.mu.Lock()
+	it.meta = resp.Meta
+	it.mu.Unlock()
+	return objs, raws, nil
 }
 
-func (it *Iterator) getMoreObjects() ([]*Object, error) {
-	var objs []*Object
-	nextURL, err := url.Parse(it.links.Next)
-	if err != nil {
-		return nil, err
+// getMoreObjectsWithHeartbeat is like getMoreObjects, but calls the heartbeat
+// function periodically while waiting for the response, if the iterator has
+// one.
+func (it *Iterator) getMoreObjectsWithHeartbeat() ([]*Object, []json.RawMessage, error) {
+	if it.metrics != nil {
+		defer it.observeSince(IteratorFetchMetric, time.Now())
+	}
+	if it.heartbeat == nil || it.heartbeatInterval <= 0 {
+		return it.getMoreObjects()
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(it.heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if it.fetchCtx.Err() == nil {
+					it.heartbeat()
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return it.getMoreObjects()
+}
+
+// isBatchSizeError returns true if err is the error returned by the backend
+// when the number of objects requested in a page is too large.
+func isBatchSizeError(err error) bool {
+	apiErr, ok := apiError(err)
+	return ok && apiErr.HTTPStatus == http.StatusBadRequest &&
+		strings.Contains(strings.ToLower(apiErr.Message), "limit")
+}
+
+// clampLinks reduces the batch size to safeBatchSize in the link to the next
+// page and in the link to the first page, which is used by Seek. It returns
+// false if the batch size was already small enough, or if the link to the
+// next page doesn't have a batch size.
+func (it *Iterator) clampLinks() bool {
+	if it.batchSize <= safeBatchSize {
+		return false
+	}
+	clamp := func(link string) (string, bool) {
+		u, err := url.Parse(link)
+		if err != nil || u.Query().Get("limit") == "" {
+			return link, false
+		}
+		q := u.Query()
+		q.Set("limit", strconv.Itoa(safeBatchSize))
+		u.RawQuery = q.Encode()
+		return u.String(), true
+	}
+	next, ok := clamp(it.links.Next)
+	if !ok {
+		return false
+	}
+	it.links.Next = next
+	if it.firstURL != "" {
+		it.firstURL, _ = clamp(it.firstURL)
+	}
+	it.batchSize = safeBatchSize
+	return true
+}
+
+// skipForward requests the descriptors of the objects to skip, see WithSkip,
+// and moves the link to the next page right after them. The link is empty if
+// the collection doesn't have more objects.
+func (it *Iterator) skipForward() error {
+	for it.toSkip > 0 && it.links.Next != "" {
+		u, err := url.Parse(it.links.Next)
+		if err != nil {
+			return err
+		}
+		u = it.client.resolve(u)
+		q := u.Query()
+		q.Set("descriptors_only", "true")
+		n := it.toSkip
+		if n > safeBatchSize {
+			n = safeBatchSize
+		}
+		q.Set("limit", strconv.Itoa(n))
+		u.RawQuery = q.Encode()
+		resp, err := it.client.GetWithContext(it.fetchCtx, u, WithRequestTimeout(it.pageTimeout))
+		if err != nil {
+			return err
+		}
+		var descriptors []json.RawMessage
+		if err := json.Unmarshal(resp.Data, &descriptors); err != nil {
+			return err
+		}
+		it.toSkip -= len(descriptors)
+		next := resp.Links.Next
+		if c, ok := resp.Meta["cursor"].(string); ok && c != "" {
+			q.Set("cursor", c)
+			u.RawQuery = q.Encode()
+			next = u.String()
+		}
+		if len(descriptors) == 0 || next == "" {
+			it.links.Next = ""
+			break
+		}
+		// Restore the parameters of the iteration in the link to the
+		// following page.
+		if u, err = url.Parse(next); err != nil {
+			return err
+		}
+		q = u.Query()
+		q.Del("descriptors_only")
+		q.Del("limit")
+		if it.descriptorsOnly {
+			q.Set("descriptors_only", "true")
+		}
+		if it.batchSize > 0 {
+			q.Set("limit", strconv.Itoa(it.batchSize))
+		}
+		u.RawQuery = q.Encode()
+		it.links.Next = u.String()
+	}
+	it.toSkip = 0
+	return nil
+}
+
+// nextPage retrieves the next page of objects from the backend, discarding
+// the first skip objects and those that don't satisfy the iterator's
+// predicate.
+func (it *Iterator) nextPage(skip int) (*page, error) {
+	if it.toSkip > 0 {
+		if err := it.skipForward(); err != nil {
+			return nil, err
+		}
+		if it.links.Next == "" {
+			// The collection has less objects than those to skip.
+			return &page{last: true, meta: it.Meta()}, nil
+		}
+	}
+	// Send request to the API to get more objects. Transient errors and rate
+	// limiting errors are retried, other errors are returned right away. In both cases it.links
+	// remains unchanged, so the failed page can be requested again by
+	// resuming the iteration from the last cursor.
+	objects, raws, err := it.getMoreObjectsWithHeartbeat()
+	if err != nil && it.clampBatchSize && isBatchSizeError(err) && it.clampLinks() {
+		it.client.logger.Debugf("vt: batch size rejected, retrying with %d: %v", safeBatchSize, err)
+		objects, raws, err = it.getMoreObjectsWithHeartbeat()
+	}
+	backoff := it.retryBackoff
+	for retries := 0; err != nil && retries < it.maxRetries; retries++ {
+		delay, shouldRetry := retryDelay(err, backoff)
+		if !shouldRetry {
+			break
+		}
+		it.client.logger.Debugf("vt: retrying page request in %v after error: %v", delay, err)
+		it.addError(err)
+		if !it.wait(delay) {
+			break
+		}
+		backoff *= 2
+		objects, raws, err = it.getMoreObjectsWithHeartbeat()
+	}
+	if err != nil && isBatchSizeError(err) {
+		return nil, fmt.Errorf("batch size %d rejected by the backend, use a "+
+			"smaller one with WithBatchSize or use WithClampBatchSize: %w", it.batchSize, err)
 	}
-	resp, err := it.client.GetData(nextURL, &objs)
 	if err != nil {
 		return nil, err
 	}
-	it.links = resp.Links
-	it.meta = resp.Meta
-	return objs, nil
+
+	if skip > len(objects) {
+		skip = len(objects)
+	}
+	objects = objects[skip:]
+	if raws != nil {
+		raws = raws[skip:]
+	}
+	p := &page{
+		objects: make([]collectionObject, 0, len(objects)),
+		meta:    it.Meta(),
+	}
+	// The backend's cursor for the objects in the page is the one used for
+	// requesting the page, except for the last one, whose cursor is the one
+	// for requesting the next page.
+	var pageCursor, nextCursor string
+	if self, err := url.Parse(it.links.Self); err == nil {
+		pageCursor = self.Query().Get("cursor")
+	}
+	nextCursor, _ = p.meta["cursor"].(string)
+	for i, object := range objects {
+		if it.predicate != nil && !it.predicate(object) {
+			continue
+		}
+		co := collectionObject{object: object}
+		if raws != nil {
+			co.raw = raws[i]
+		}
+		if i == len(objects)-1 && it.links.Next != "" {
+			// The cursor for the last object in the page points to the
+			// beginning of the next page. For the last object in the
+			// collection it points past the end of the last page.
+			co.cursor.Link = it.links.Next
+			co.cursor.Offset = 0
+			co.serverCursor = nextCursor
+		} else {
+			co.serverCursor = pageCursor
+			co.cursor.Link = it.links.Self
+			co.cursor.Offset = skip + i + 1
+		}
+		p.objects = append(p.objects, co)
+	}
+	p.last = len(objects) == 0 || it.links.Next == ""
+
+	return p, nil
+}
+
+// pageResult is a page, or the error that occurred while retrieving it.
+type pageResult struct {
+	page *page
+	err  error
+}
+
+// prefetchPages retrieves pages from the backend and sends them through ch,
+// until the last page is retrieved, an error occurs, or the iterator is
+// closed. If first is not nil it's sent before retrieving any other page.
+func (it *Iterator) prefetchPages(skip int, first *page, ch chan<- pageResult) {
+	defer close(ch)
+	p := first
+	for {
+		var err error
+		if p == nil {
+			p, err = it.nextPage(skip)
+			skip = 0
+		}
+		select {
+		case ch <- pageResult{page: p, err: err}:
+		case <-it.fetchCtx.Done():
+			return
+		}
+		if err != nil || p.last {
+			return
+		}
+		p = nil
+	}
+}
+
+// pageSource returns a function that returns the next page each time it's
+// called, or nil when there are no more pages. If first is not nil it's the
+// first page returned. When the iterator is prefetching the function returns
+// pages that were retrieved in advance by another goroutine. The second
+// function returned waits until that goroutine finishes, which happens once
+// all pages were retrieved or the iterator is closed.
+func (it *Iterator) pageSource(skip int, first *page) (func() (*page, error), func()) {
+	if it.prefetch <= 0 {
+		next := func() (*page, error) {
+			p := first
+			first = nil
+			if p == nil {
+				var err error
+				if p, err = it.nextPage(skip); err != nil {
+					return nil, err
+				}
+			}
+			skip = 0
+			return p, nil
+		}
+		return next, func() {}
+	}
+	ch := make(chan pageResult, it.prefetch-1)
+	go it.prefetchPages(skip, first, ch)
+	next := func() (*page, error) {
+		r, ok := <-ch
+		if !ok {
+			return nil, nil
+		}
+		return r.page, r.err
+	}
+	wait := func() {
+		for range ch {
+		}
+	}
+	return next, wait
 }
 
-func (it *Iterator) iterate(skip int) {
+// iterate retrieves pages from the backend and sends their objects through the
+// iterator's channel. If first is not nil it's sent before retrieving any
+// other page.
+func (it *Iterator) iterate(skip int, first *page) {
+	// Once there are no more objects to send stop any goroutine that may be
+	// still prefetching pages, and wait for it to finish before closing the
+	// channel, so that no goroutine is left behind once the channel is
+	// closed.
+	nextPage, wait := it.pageSource(skip, first)
+	defer close(it.ch)
+	defer wait()
+	defer it.cancel()
 	sent := 0
-loop:
 	for it.limit == 0 || sent < it.limit {
-		// Send request to the API to get more objects.
-		objects, err := it.getMoreObjects()
+		p, err := nextPage()
 		if err != nil {
 			// If an error occurred send it through the channel
-			if it.sendToChannel(err) == stop {
-				break loop
-			}
+			it.sendToChannel(err)
+			return
+		}
+		if p == nil {
+			break
 		}
 
-		objects = objects[skip:]
-		for i, object := range objects {
-			co := collectionObject{object: object}
-			if i == len(objects)-1 {
-				co.cursor.Link = it.links.Next
-				co.cursor.Offset = 0
-			} else {
-				co.cursor.Link = it.links.Self
-				co.cursor.Offset = skip + i + 1
-			}
+		for _, co := range p.objects {
 			if it.sendToChannel(co) == stop {
-				break loop
+				return
 			}
 			sent++
 		}
+		it.reportProgress(sent, p)
 
-		if len(objects) == 0 || it.links.Next == "" {
-			break loop
+		if p.last {
+			break
 		}
+	}
+	it.finished = true
+}
 
-		skip = 0
+// Collect returns all the objects in the collection, up to the limit set with
+// WithLimit, if any. It returns the first error encountered while iterating
+// the collection. Notice that all objects are kept in memory, which makes this
+// function inappropriate for large collections, use Next and Get for those.
+// The iterator is closed when this function returns.
+func (it *Iterator) Collect() ([]*Object, error) {
+	defer it.Close()
+	var objs []*Object
+	for it.Next() {
+		objs = append(objs, it.Get())
 	}
-	it.closed = true
-	close(it.ch)
-	close(it.done)
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// ErrStopIteration can be returned by the function passed to ForEach for
+// stopping the iteration without error.
+var ErrStopIteration = errors.New("stop iteration")
+
+// ForEach calls fn for every object returned by the iterator. If fn returns
+// an error the iteration stops and ForEach returns that error, except for
+// ErrStopIteration, which stops the iteration but makes ForEach return nil.
+// If the iteration stops due to an error while retrieving the objects, that
+// error is returned. The iterator is closed when this function returns.
+func (it *Iterator) ForEach(fn func(*Object) error) error {
+	defer it.Close()
+	for it.Next() {
+		if err := fn(it.Get()); err == ErrStopIteration {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// ForEachParallel is like ForEach, but calls fn from the given number of
+// goroutines, so that up to workers objects are processed concurrently. The
+// objects are read from the iterator by the calling goroutine, and are not
+// necessarily processed in the same order in which they are returned by the
+// iterator. When fn returns an error no more objects are passed to fn, though
+// calls that are already running in other goroutines are not interrupted, and
+// the error is recorded once they finish.
+// ForEachParallel returns after all calls to fn have finished, with the
+// first error returned by fn, or the error occurred while retrieving the
+// objects, if any. The iterator is closed when this function returns.
+func (it *Iterator) ForEachParallel(workers int, fn func(*Object) error) error {
+	defer it.Close()
+	if workers < 1 {
+		workers = 1
+	}
+	// mu is read-locked while calling fn and write-locked while recording
+	// an error, so stopped can't change between checking it and calling fn.
+	var mu sync.RWMutex
+	var firstErr error
+	stopped := false
+	// call calls fn unless the iteration was already stopped by an error.
+	call := func(obj *Object) {
+		mu.RLock()
+		var err error
+		if !stopped {
+			err = fn(obj)
+		}
+		mu.RUnlock()
+		if err != nil {
+			mu.Lock()
+			if !stopped {
+				stopped, firstErr = true, err
+			}
+			mu.Unlock()
+		}
+	}
+	isStopped := func() bool {
+		mu.RLock()
+		defer mu.RUnlock()
+		return stopped
+	}
+	objs := make(chan *Object)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for obj := range objs {
+				call(obj)
+			}
+		}()
+	}
+	for !isStopped() && it.Next() {
+		objs <- it.Get()
+	}
+	close(objs)
+	wg.Wait()
+	if firstErr == ErrStopIteration {
+		return nil
+	} else if firstErr != nil {
+		return firstErr
+	}
+	return it.Error()
+}
+
+type deleteAllOptions struct {
+	continueOnError bool
+}
+
+// DeleteAllOption represents an option passed to Iterator.DeleteAll.
+type DeleteAllOption func(*deleteAllOptions)
+
+// WithContinueOnError receives a boolean that indicates whether or not
+// DeleteAll must continue deleting objects after a failed deletion.
+func WithContinueOnError(b bool) DeleteAllOption {
+	return func(opts *deleteAllOptions) {
+		opts.continueOnError = b
+	}
+}
+
+// DeleteAll deletes every object returned by the iterator by sending a DELETE
+// request to the object's URL, which is taken from its "self" link. It returns
+// the number of deleted objects. By default it stops at the first error, which
+// is returned along with the number of objects deleted so far. With
+// WithContinueOnError(true) it continues with the remaining objects and
+// returns the first error at the end. The iterator is closed when this
+// function returns.
+func (it *Iterator) DeleteAll(cli *Client, options ...DeleteAllOption) (int, error) {
+	o := &deleteAllOptions{}
+	for _, opt := range options {
+		opt(o)
+	}
+	defer it.Close()
+	deleted := 0
+	var firstErr error
+	for it.Next() {
+		err := deleteObject(cli, it.Get())
+		if err == nil {
+			deleted++
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if !o.continueOnError {
+			return deleted, firstErr
+		}
+	}
+	if err := it.Error(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return deleted, firstErr
+}
+
+func deleteObject(cli *Client, obj *Object) error {
+	if obj.Links.Self == "" {
+		return fmt.Errorf("object %s of type %s doesn't have a self link", obj.ID, obj.Type)
+	}
+	u, err := url.Parse(obj.Links.Self)
+	if err != nil {
+		return err
+	}
+	_, err = cli.Delete(u)
+	return err
+}
+
+// WriteJSONArray writes the objects returned by the iterator to w as a JSON
+// array. Objects are written one by one as they are retrieved from the
+// backend, so the collection is never held in memory as a whole. The iterator
+// is closed when this function returns.
+func (it *Iterator) WriteJSONArray(w io.Writer) error {
+	defer it.Close()
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	first := true
+	for it.Next() {
+		b, err := json.Marshal(it.Get())
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		first = false
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// WriteNDJSON writes the objects returned by the iterator to w as
+// newline-delimited JSON, one object per line, and returns the number of
+// objects written. Like with WriteJSONArray, objects are written as they are
+// retrieved from the backend. If the iterator was created with
+// WithRawJSON(true) the JSON returned by the backend for each object is
+// written, compacted into a single line, instead of the JSON produced by
+// Object.MarshalJSON. It stops at the first error, either while iterating or
+// while writing, and returns it together with the number of objects already
+// written. If w has a Flush method, like a *bufio.Writer, it's called before
+// returning, even if there was an error. The iterator is closed when this
+// function returns.
+func (it *Iterator) WriteNDJSON(w io.Writer) (n int, err error) {
+	defer it.Close()
+	if f, ok := w.(interface{ Flush() error }); ok {
+		defer func() {
+			if flushErr := f.Flush(); err == nil {
+				err = flushErr
+			}
+		}()
+	}
+	var line bytes.Buffer
+	for it.Next() {
+		line.Reset()
+		if raw := it.Raw(); raw != nil {
+			err = json.Compact(&line, raw)
+		} else {
+			var b []byte
+			b, err = json.Marshal(it.Get())
+			line.Write(b)
+		}
+		if err != nil {
+			return n, err
+		}
+		line.WriteByte('\n')
+		if _, err = w.Write(line.Bytes()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, it.Error()
 }
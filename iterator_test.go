@@ -0,0 +1,1571 @@
+package vt
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIteratorWriteJSONArray(t *testing.T) {
+	for _, n := range []int{0, 1, 25} {
+		cli := newTestClient(t, collectionHandler(testObjects(n), 10))
+		it, err := cli.Iterator(URL("collection"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err := it.WriteJSONArray(&b); err != nil {
+			t.Fatal(err)
+		}
+		var objs []*Object
+		if err := json.Unmarshal(b.Bytes(), &objs); err != nil {
+			t.Fatalf("invalid JSON array %q: %v", b.String(), err)
+		}
+		expectIDs(t, ids(objs), 0, n)
+	}
+}
+
+func TestIteratorWithSharedResponses(t *testing.T) {
+	// Pages are read as a whole when responses can be cached or shared, and
+	// decoded as they are read otherwise, with the same results.
+	for _, opt := range []ClientOption{WithResponseCache(NewMemoryCache()), WithSingleflight(true), WithCompression(false)} {
+		cli := newTestClient(t, collectionHandler(testObjects(25), 10), opt)
+		it, err := cli.Iterator(URL("collection"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for it.Next() {
+			got = append(got, it.Get().ID)
+		}
+		if err := it.Error(); err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, got, 0, 25)
+	}
+}
+
+func TestIteratorWriteNDJSON(t *testing.T) {
+	for _, rawJSON := range []bool{false, true} {
+		cli := newTestClient(t, collectionHandler(testObjects(25), 10))
+		it, err := cli.Iterator(URL("collection"), WithRawJSON(rawJSON))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		w := bufio.NewWriter(&b)
+		n, err := it.WriteNDJSON(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+		if n != 25 || len(lines) != 25 {
+			t.Fatalf("wrote %d objects in %d lines, expecting 25", n, len(lines))
+		}
+		var got []string
+		for _, line := range lines {
+			obj := &Object{}
+			if err := json.Unmarshal([]byte(line), obj); err != nil {
+				t.Fatalf("invalid JSON line %q: %v", line, err)
+			}
+			got = append(got, obj.ID)
+		}
+		expectIDs(t, got, 0, 25)
+	}
+
+	// The objects written before an error are flushed.
+	handler := collectionHandler(testObjects(25), 10)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cursor") == "10" {
+			writeError(w, http.StatusForbidden, "ForbiddenError")
+			return
+		}
+		handler(w, r)
+	})
+	it, err := cli.Iterator(URL("collection"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	n, err := it.WriteNDJSON(bufio.NewWriter(&b))
+	if err == nil || n != 10 || strings.Count(b.String(), "\n") != 10 {
+		t.Errorf("wrote %d objects, %d lines before error %v", n, strings.Count(b.String(), "\n"), err)
+	}
+}
+
+func TestIteratorWithMinMalicious(t *testing.T) {
+	objs := testObjects(30)
+	for i, obj := range objs {
+		// Objects with odd IDs are detected by i engines, objects with even IDs
+		// don't have analysis stats at all.
+		if i%2 == 1 {
+			obj["attributes"] = map[string]interface{}{
+				"last_analysis_stats": map[string]interface{}{"malicious": i}}
+		}
+	}
+	cli := newTestClient(t, collectionHandler(objs, 7))
+	it, err := cli.Iterator(URL("collection"), WithMinMalicious(10), WithLimit(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	var got []string
+	for it.Next() {
+		got = append(got, it.Get().ID)
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"11", "13", "15", "17", "19"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("got %v, expecting %v", got, expected)
+	}
+}
+
+func TestIteratorWithHeartbeat(t *testing.T) {
+	handler := collectionHandler(testObjects(3), 10)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		handler(w, r)
+	})
+	var beats int32
+	it, err := cli.Iterator(URL("collection"),
+		WithHeartbeat(20*time.Millisecond, func() { atomic.AddInt32(&beats, 1) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	objs := 0
+	for it.Next() {
+		objs++
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if objs != 3 {
+		t.Errorf("got %d objects, expecting 3", objs)
+	}
+	if n := atomic.LoadInt32(&beats); n < 2 {
+		t.Errorf("got %d heartbeats during a 200ms fetch with a 20ms interval", n)
+	}
+}
+
+func TestIteratorWithSynchronous(t *testing.T) {
+	cli := newTestClient(t, collectionHandler(testObjects(25), 10))
+	collect := func(options ...IteratorOption) ([]string, []string) {
+		it, err := cli.Iterator(URL("collection"), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer it.Close()
+		var objs, cursors []string
+		for it.Next() {
+			objs = append(objs, it.Get().ID)
+			cursors = append(cursors, it.Cursor())
+		}
+		if err := it.Error(); err != nil {
+			t.Fatal(err)
+		}
+		if count, _ := it.Meta()["count"].(float64); count != 25 {
+			t.Errorf("got meta %v", it.Meta())
+		}
+		return objs, cursors
+	}
+	odd := WithPredicate(func(obj *Object) bool {
+		n, _ := obj.GetAttributeInt64("size")
+		return n%2 == 1
+	})
+	for _, options := range [][]IteratorOption{
+		nil,
+		{WithLimit(12)},
+		{WithBatchSize(7)},
+		{odd, WithLimit(8)},
+	} {
+		asyncObjs, asyncCursors := collect(options...)
+		syncObjs, syncCursors := collect(append(options, WithSynchronous(true))...)
+		if !reflect.DeepEqual(asyncObjs, syncObjs) {
+			t.Errorf("synchronous iterator returned %v, expecting %v", syncObjs, asyncObjs)
+		}
+		if !reflect.DeepEqual(asyncCursors, syncCursors) {
+			t.Errorf("synchronous iterator returned different cursors")
+		}
+		// Resuming from a cursor must continue where the iterator left.
+		if len(syncCursors) > 3 {
+			resumed, _ := collect(append(options, WithSynchronous(true), WithCursor(syncCursors[2]))...)
+			if len(resumed) == 0 || resumed[0] != syncObjs[3] {
+				t.Errorf("resuming from cursor returned %v, expecting %v first", resumed, syncObjs[3])
+			}
+		}
+	}
+
+	// Errors are reported in the same way.
+	cli = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "NotFoundError")
+	})
+	for _, synchronous := range []bool{false, true} {
+		it, err := cli.Iterator(URL("collection"), WithSynchronous(synchronous))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if it.Next() || it.Get() != nil || !IsNotFound(it.Error()) {
+			t.Errorf("got error %v from iterator with synchronous=%v", it.Error(), synchronous)
+		}
+		it.Close()
+	}
+}
+
+func TestIteratorDeleteAll(t *testing.T) {
+	objs := testObjects(12)
+	var mu sync.Mutex
+	var deleted []string
+	handler := collectionHandler(objs, 5)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			handler(w, r)
+			return
+		}
+		if r.Method != "DELETE" {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/v3/files/")
+		if id == "7" {
+			writeError(w, http.StatusForbidden, "ForbiddenError")
+			return
+		}
+		mu.Lock()
+		deleted = append(deleted, id)
+		mu.Unlock()
+		writeResponse(w, http.StatusOK, map[string]interface{}{})
+	})
+	for _, obj := range objs {
+		obj["links"] = map[string]string{"self": URL("files/%s", obj["id"]).String()}
+	}
+
+	it, err := cli.Iterator(URL("collection"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := it.DeleteAll(cli)
+	if err == nil {
+		t.Error("expecting error when deleting object 7")
+	}
+	expectIDs(t, deleted, 0, 7)
+	if n != 7 {
+		t.Errorf("got %d deleted objects, expecting 7", n)
+	}
+
+	deleted = nil
+	it, err = cli.Iterator(URL("collection"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err = it.DeleteAll(cli, WithContinueOnError(true))
+	if err == nil {
+		t.Error("expecting error when deleting object 7")
+	}
+	if n != 11 || len(deleted) != 11 {
+		t.Errorf("got %d deleted objects, expecting 11", n)
+	}
+}
+
+func TestIteratorWithEagerFirstPage(t *testing.T) {
+	handler := collectionHandler(testObjects(15), 10)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Apikey") != "apikey" {
+			writeError(w, http.StatusUnauthorized, "WrongCredentialsError")
+			return
+		}
+		handler(w, r)
+	})
+
+	for _, sync := range []bool{false, true} {
+		it, err := cli.Iterator(URL("collection"),
+			WithEagerFirstPage(true), WithSynchronous(sync))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for it.Next() {
+			got = append(got, it.Get().ID)
+		}
+		it.Close()
+		if err := it.Error(); err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, got, 0, 15)
+	}
+
+	cli.APIKey = "wrong"
+	it, err := cli.Iterator(URL("collection"), WithEagerFirstPage(true))
+	if it != nil {
+		t.Error("expecting nil iterator")
+	}
+	if apiErr, ok := apiError(err); !ok || apiErr.HTTPStatus != http.StatusUnauthorized {
+		t.Errorf("expecting 401 error, got %v", err)
+	}
+}
+
+func TestIteratorWithContext(t *testing.T) {
+	handler := collectionHandler(testObjects(20), 10)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cursor") != "" {
+			// The second page never arrives unless the request is aborted.
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		handler(w, r)
+	})
+	for _, sync := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		it, err := cli.Iterator(URL("collection"), WithContext(ctx), WithSynchronous(sync))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		start := time.Now()
+		for it.Next() {
+			if n++; n == 10 {
+				// Cancel while the iterator waits for the second page.
+				time.AfterFunc(50*time.Millisecond, cancel)
+			}
+		}
+		it.Close()
+		if n != 10 {
+			t.Errorf("got %d objects, expecting 10", n)
+		}
+		if err := it.Error(); err != context.Canceled {
+			t.Errorf("got error %v, expecting %v", err, context.Canceled)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("cancelled iterator took %v to finish", elapsed)
+		}
+		cancel()
+	}
+}
+
+func TestIteratorCollect(t *testing.T) {
+	cli := newTestClient(t, collectionHandler(testObjects(250), 40))
+	for _, tc := range []struct {
+		options  []IteratorOption
+		expected int
+	}{
+		{nil, 250},
+		{[]IteratorOption{WithLimit(100)}, 100},
+		{[]IteratorOption{WithLimit(100), WithSynchronous(true)}, 100},
+	} {
+		it, err := cli.Iterator(URL("collection"), tc.options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objs, err := it.Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, ids(objs), 0, tc.expected)
+	}
+}
+
+func TestIteratorPersistentError(t *testing.T) {
+	var requests int32
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		writeError(w, http.StatusInternalServerError, "InternalError")
+	})
+	for _, options := range [][]IteratorOption{nil, {WithCursor((&cursor{Link: URL("collection").String(), Offset: 5}).encode())}} {
+		atomic.StoreInt32(&requests, 0)
+		it, err := cli.Iterator(URL("collection"), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if it.Next() {
+			t.Fatal("iterator returned an object from a failing collection")
+		}
+		if err := it.Error(); err == nil {
+			t.Fatal("expecting error")
+		}
+		it.err = nil
+		if it.Next() || it.Error() != nil {
+			t.Errorf("iterator continued after a persistent error: %v", it.Error())
+		}
+		it.Close()
+		if n := atomic.LoadInt32(&requests); n != 1 {
+			t.Errorf("failing page was requested %d times, expecting 1", n)
+		}
+	}
+}
+
+func TestIteratorTransientError(t *testing.T) {
+	defer func(d time.Duration) { pageRetryBackoff = d }(pageRetryBackoff)
+	pageRetryBackoff = time.Millisecond
+
+	var failures int32
+	handler := collectionHandler(testObjects(25), 10)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// The second page fails twice before succeeding.
+		if r.URL.Query().Get("cursor") == "10" && atomic.AddInt32(&failures, 1) <= 2 {
+			writeError(w, http.StatusServiceUnavailable, "TransientError")
+			return
+		}
+		handler(w, r)
+	})
+	it, err := cli.Iterator(URL("collection"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, ids(objs), 0, 25)
+}
+
+func TestIteratorErrors(t *testing.T) {
+	defer func(d time.Duration) { pageRetryBackoff = d }(pageRetryBackoff)
+	pageRetryBackoff = time.Millisecond
+
+	var failures int32
+	handler := collectionHandler(testObjects(25), 10)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("cursor") {
+		case "10":
+			// The second page fails twice before succeeding.
+			if atomic.AddInt32(&failures, 1) <= 2 {
+				writeError(w, http.StatusServiceUnavailable, "TransientError")
+				return
+			}
+		case "20":
+			writeError(w, http.StatusForbidden, "ForbiddenError")
+			return
+		}
+		handler(w, r)
+	})
+	it, err := cli.Iterator(URL("collection"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for it.Next() {
+		got = append(got, it.Get().ID)
+	}
+	expectIDs(t, got, 0, 20)
+	errs := it.Errors()
+	if len(errs) != 3 || !IsTransient(errs[0]) || !IsTransient(errs[1]) || errs[2] != it.Error() {
+		t.Errorf("got errors %v", errs)
+	}
+}
+
+func TestIteratorWithSkipMalformed(t *testing.T) {
+	objs := testObjects(5)
+	objs[2]["attributes"] = "malformed"
+	cli := newTestClient(t, collectionHandler(objs, 10))
+
+	// By default a malformed object stops the iteration.
+	it, err := cli.Iterator(URL("collection"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.Collect(); err == nil {
+		t.Error("expecting error for malformed object")
+	}
+
+	for _, synchronous := range []bool{false, true} {
+		it, err := cli.Iterator(URL("collection"),
+			WithSkipMalformed(true), WithSynchronous(synchronous))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := it.Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := ids(got); !reflect.DeepEqual(ids, []string{"0", "1", "3", "4"}) {
+			t.Errorf("got objects %v", ids)
+		}
+		if errs := it.Errors(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "malformed") {
+			t.Errorf("got errors %v", errs)
+		}
+	}
+}
+
+// testMetricsSink is a MetricsSink that counts the observations for each name.
+type testMetricsSink struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (s *testMetricsSink) ObserveDuration(name string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d < 0 {
+		panic("negative duration")
+	}
+	s.counts[name]++
+}
+
+func TestIteratorWithMetrics(t *testing.T) {
+	cli := newTestClient(t, collectionHandler(testObjects(25), 10))
+	for _, synchronous := range []bool{false, true} {
+		sink := &testMetricsSink{counts: map[string]int{}}
+		it, err := cli.Iterator(URL("collection"),
+			WithMetrics(sink), WithSynchronous(synchronous))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := it.Collect(); err != nil {
+			t.Fatal(err)
+		}
+		sink.mu.Lock()
+		expected := map[string]int{
+			IteratorFetchMetric:    3,
+			IteratorSendWaitMetric: 25,
+			IteratorNextWaitMetric: 25,
+		}
+		if synchronous {
+			delete(expected, IteratorSendWaitMetric)
+		}
+		if !reflect.DeepEqual(sink.counts, expected) {
+			t.Errorf("got observations %v with synchronous=%v, expecting %v",
+				sink.counts, synchronous, expected)
+		}
+		sink.mu.Unlock()
+	}
+}
+
+func TestIteratorWithClampBatchSize(t *testing.T) {
+	handler := collectionHandler(testObjects(100), 10)
+	var limits []string
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		limit := r.URL.Query().Get("limit")
+		limits = append(limits, limit)
+		if n, _ := strconv.Atoi(limit); n > 40 {
+			writeResponse(w, http.StatusBadRequest, map[string]interface{}{
+				"error": map[string]string{
+					"code":    "BadRequestError",
+					"message": "Invalid limit, the maximum is 40"}})
+			return
+		}
+		handler(w, r)
+	})
+
+	if _, err := cli.Iterator(URL("collection"), WithBatchSize(0)); err == nil {
+		t.Error("expecting error for zero batch size")
+	}
+
+	it, err := cli.Iterator(URL("collection"), WithBatchSize(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it.Next() || it.Error() == nil || !strings.Contains(it.Error().Error(), "WithClampBatchSize") {
+		t.Errorf("got error %v for large batch size", it.Error())
+	}
+	if apiErr, ok := apiError(it.Error()); !ok || apiErr.Code != "BadRequestError" {
+		t.Errorf("got error %#v, expecting the backend's error to be wrapped", it.Error())
+	}
+
+	limits = nil
+	it, err = cli.Iterator(URL("collection"), WithBatchSize(100), WithClampBatchSize(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, ids(objs), 0, 100)
+	if !reflect.DeepEqual(limits, []string{"100", "40", "40", "40"}) {
+		t.Errorf("got limits %v", limits)
+	}
+}
+
+func TestIteratorWithSkip(t *testing.T) {
+	handler := collectionHandler(testObjects(50), 10)
+	var mu sync.Mutex
+	var queries []string
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		mu.Lock()
+		queries = append(queries, q.Get("descriptors_only")+":"+q.Get("limit"))
+		mu.Unlock()
+		handler(w, r)
+	})
+
+	for _, synchronous := range []bool{false, true} {
+		queries = nil
+		it, err := cli.Iterator(URL("collection"),
+			WithSkip(23), WithBatchSize(10), WithSynchronous(synchronous))
+		if err != nil {
+			t.Fatal(err)
+		}
+		objs, err := it.Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, ids(objs), 23, 50)
+		// The skipped objects are requested as descriptors in a single page.
+		mu.Lock()
+		if !reflect.DeepEqual(queries, []string{"true:23", ":10", ":10", ":10"}) {
+			t.Errorf("got queries %v", queries)
+		}
+		mu.Unlock()
+	}
+
+	// The limit applies to the objects returned after skipping.
+	it, err := cli.Iterator(URL("collection"), WithSkip(45), WithLimit(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, ids(objs), 45, 48)
+
+	// Skipping more objects than the collection has.
+	it, err = cli.Iterator(URL("collection"), WithSkip(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if it.Next() || it.Error() != nil || !it.Completed() {
+		t.Errorf("got error %v, completed %v after skipping past the end", it.Error(), it.Completed())
+	}
+
+	// Reset skips the objects again.
+	it, err = cli.Iterator(URL("collection"), WithSkip(48), WithSynchronous(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for it.Next() {
+	}
+	if err := it.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next() || it.Get().ID != "48" {
+		t.Errorf("got %v after reset", it.Get())
+	}
+
+	if _, err := cli.Iterator(URL("collection"), WithSkip(10), WithCursor("foo")); err == nil {
+		t.Error("expecting error for WithSkip and WithCursor")
+	}
+}
+
+func TestIteratorCompleted(t *testing.T) {
+	for _, synchronous := range []bool{false, true} {
+		cli := newTestClient(t, collectionHandler(testObjects(25), 10))
+		it, err := cli.Iterator(URL("collection"), WithSynchronous(synchronous))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for it.Next() {
+			if it.Completed() {
+				t.Errorf("iterator completed after %d objects", it.Count())
+			}
+		}
+		if !it.Completed() || it.Count() != 25 || it.Error() != nil {
+			t.Errorf("got completed %v, count %d, error %v", it.Completed(), it.Count(), it.Error())
+		}
+
+		// Empty collections are completed too.
+		cli = newTestClient(t, collectionHandler(nil, 10))
+		it, err = cli.Iterator(URL("collection"), WithSynchronous(synchronous))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if it.Next() || !it.Completed() || it.Count() != 0 {
+			t.Errorf("got completed %v, count %d for empty collection", it.Completed(), it.Count())
+		}
+
+		// Iterators closed early or stopped by an error are not.
+		cli = newTestClient(t, collectionHandler(testObjects(25), 10))
+		it, err = cli.Iterator(URL("collection"), WithSynchronous(synchronous), WithBatchSize(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3 && it.Next(); i++ {
+		}
+		it.Close()
+		for it.Next() {
+		}
+		if it.Completed() {
+			t.Errorf("iterator completed after being closed, count %d", it.Count())
+		}
+
+		cli = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusForbidden, "ForbiddenError")
+		})
+		it, err = cli.Iterator(URL("collection"), WithSynchronous(synchronous))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if it.Next() || it.Completed() || it.Error() == nil {
+			t.Errorf("got completed %v, error %v", it.Completed(), it.Error())
+		}
+	}
+}
+
+func TestIteratorWithParam(t *testing.T) {
+	handler := collectionHandler(testObjects(15), 10)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("relationships") != "comments" || q.Get("filter") != "foo" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		handler(w, r)
+	})
+	it, err := cli.Iterator(URL("collection?relationships=votes"),
+		WithParam("relationships", "comments"), WithFilter("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, ids(objs), 0, 15)
+
+	if _, err := cli.Iterator(URL("collection"), WithParam("filter", "foo")); err == nil {
+		t.Error("expecting error for reserved parameter")
+	}
+}
+
+func TestIteratorWithPrefetch(t *testing.T) {
+	cli := newTestClient(t, collectionHandler(testObjects(95), 10))
+	it, err := cli.Iterator(URL("collection"), WithPrefetch(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	var cursors []string
+	for it.Next() {
+		got = append(got, it.Get().ID)
+		cursors = append(cursors, it.Cursor())
+	}
+	it.Close()
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, got, 0, 95)
+	it, err = cli.Iterator(URL("collection"), WithPrefetch(3), WithCursor(cursors[41]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, ids(objs), 42, 95)
+}
+
+func TestIteratorWithPrefetchClose(t *testing.T) {
+	aborted := make(chan struct{})
+	handler := collectionHandler(testObjects(50), 10)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cursor") == "20" {
+			// The third page never arrives unless the request is aborted.
+			select {
+			case <-r.Context().Done():
+				close(aborted)
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		handler(w, r)
+	})
+	it, err := cli.Iterator(URL("collection"), WithPrefetch(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next() {
+		t.Fatal(it.Error())
+	}
+	// Give the iterator some time for prefetching the pages.
+	time.Sleep(100 * time.Millisecond)
+	it.Close()
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Error("closing the iterator didn't abort the prefetch request")
+	}
+}
+
+// iterateGoroutines returns the number of goroutines running Iterator.iterate.
+func iterateGoroutines() int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return strings.Count(string(buf[:n]), "(*Iterator).iterate(")
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+func TestIteratorCancelWithoutDraining(t *testing.T) {
+	cli := newTestClient(t, collectionHandler(testObjects(200), 10))
+	before := iterateGoroutines()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	it, err := cli.Iterator(URL("collection"), WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait until the channel is full and the goroutine blocks sending to it.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(it.ch) < cap(it.ch) {
+		if time.Now().After(deadline) {
+			t.Fatal("the iterator didn't fill its channel")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	deadline = time.Now().Add(time.Second)
+	for iterateGoroutines() > before {
+		if time.Now().After(deadline) {
+			t.Fatal("the iterator's goroutine didn't return after cancelling its context")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestIteratorClose(t *testing.T) {
+	cli := newTestClient(t, collectionHandler(testObjects(200), 10))
+	// closeWithin calls Close on it and fails if it doesn't return soon.
+	closeWithin := func(it *Iterator) {
+		done := make(chan struct{})
+		go func() {
+			it.Close()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Close blocked")
+		}
+	}
+	for _, synchronous := range []bool{false, true} {
+		before := iterateGoroutines()
+
+		// Close before the iteration finished.
+		it, err := cli.Iterator(URL("collection"), WithSynchronous(synchronous))
+		if err != nil {
+			t.Fatal(err)
+		}
+		it.Next()
+		closeWithin(it)
+		// The objects already retrieved are not returned after Close.
+		if it.Next() || it.HasNext() {
+			t.Error("Next returned true after Close")
+		}
+		closeWithin(it)
+
+		// Close after the iteration finished, and twice.
+		it, err = cli.Iterator(URL("collection"), WithSynchronous(synchronous), WithLimit(15))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for it.Next() {
+		}
+		closeWithin(it)
+		closeWithin(it)
+		if it.Next() {
+			t.Error("Next returned true after Close")
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for iterateGoroutines() > before {
+			if time.Now().After(deadline) {
+				t.Fatal("the iterator's goroutine didn't return after Close")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestIteratorWithProgress(t *testing.T) {
+	type progress struct{ done, total int }
+	objs := testObjects(25)
+	handler := collectionHandler(objs, 10)
+	withoutCount := func(w http.ResponseWriter, r *http.Request) {
+		writeResponse(w, http.StatusOK, map[string]interface{}{"data": objs[:5]})
+	}
+	for _, tc := range []struct {
+		handler  http.HandlerFunc
+		options  []IteratorOption
+		expected []progress
+	}{
+		{handler, nil, []progress{{10, 25}, {20, 25}, {25, 25}}},
+		{handler, []IteratorOption{WithSynchronous(true)}, []progress{{10, 25}, {20, 25}, {25, 25}}},
+		{handler, []IteratorOption{WithLimit(15), WithSynchronous(true)}, []progress{{10, 25}, {15, 25}}},
+		{withoutCount, nil, []progress{{5, -1}}},
+	} {
+		cli := newTestClient(t, tc.handler)
+		var got []progress
+		it, err := cli.Iterator(URL("collection"), append(tc.options,
+			WithProgress(func(done, total int) { got = append(got, progress{done, total}) }))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := it.Collect(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("got progress %v, expecting %v", got, tc.expected)
+		}
+	}
+}
+
+func TestIteratorWithOrder(t *testing.T) {
+	var orders []string
+	handler := collectionHandler(testObjects(15), 10)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		orders = append(orders, r.URL.Query().Get("order"))
+		handler(w, r)
+	})
+	it, err := cli.Iterator(URL("collection"),
+		WithOrder("last_submission_date-"), WithSynchronous(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cursor string
+	for it.Next() {
+		if cursor == "" {
+			cursor = it.Cursor()
+		}
+	}
+	it.Close()
+	// The order must be preserved in the next links returned by the backend.
+	expected := []string{"last_submission_date-", "last_submission_date-"}
+	if !reflect.DeepEqual(orders, expected) {
+		t.Errorf("got orders %v, expecting %v", orders, expected)
+	}
+
+	orders = nil
+	it, err = cli.Iterator(URL("collection"), WithOrder("size+"),
+		WithCursor(cursor), WithLimit(1), WithSynchronous(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	it.Collect()
+	if !reflect.DeepEqual(orders, expected[:1]) {
+		t.Errorf("got orders %v when resuming from cursor, expecting %v", orders, expected[:1])
+	}
+}
+
+func TestIteratorWithRawJSON(t *testing.T) {
+	const raw = `{"type":"file","id":"foo","attributes":{"size":3},"unknown":[1,2]}`
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		io.WriteString(gw, `{"data":[`+raw+`]}`)
+		gw.Close()
+	})
+	for _, rawJSON := range []bool{true, false} {
+		it, err := cli.Iterator(URL("collection"), WithRawJSON(rawJSON))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !it.Next() {
+			t.Fatal(it.Error())
+		}
+		if it.Get().ID != "foo" {
+			t.Errorf("got object %q, expecting \"foo\"", it.Get().ID)
+		}
+		if rawJSON && string(it.Raw()) != raw {
+			t.Errorf("got raw JSON %s, expecting %s", it.Raw(), raw)
+		}
+		if !rawJSON && it.Raw() != nil {
+			t.Errorf("got raw JSON %s without WithRawJSON", it.Raw())
+		}
+		it.Close()
+	}
+}
+
+func TestIteratorForEach(t *testing.T) {
+	cli := newTestClient(t, collectionHandler(testObjects(25), 10))
+	errFoo := errors.New("foo")
+	for _, tc := range []struct {
+		stopAt   string
+		stopWith error
+		expected error
+		objects  int
+	}{
+		{"", nil, nil, 25},
+		{"12", ErrStopIteration, nil, 13},
+		{"7", errFoo, errFoo, 8},
+	} {
+		it, err := cli.Iterator(URL("collection"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		err = it.ForEach(func(obj *Object) error {
+			got = append(got, obj.ID)
+			if obj.ID == tc.stopAt {
+				return tc.stopWith
+			}
+			return nil
+		})
+		if err != tc.expected {
+			t.Errorf("got error %v, expecting %v", err, tc.expected)
+		}
+		expectIDs(t, got, 0, tc.objects)
+	}
+
+	// Errors from the backend are returned too.
+	cli = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusForbidden, "ForbiddenError")
+	})
+	it, err := cli.Iterator(URL("collection"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := it.ForEach(func(*Object) error { return nil }); err == nil {
+		t.Error("expecting ForbiddenError")
+	}
+}
+
+func TestIteratorForEachParallel(t *testing.T) {
+	cli := newTestClient(t, collectionHandler(testObjects(100), 10))
+	it, err := cli.Iterator(URL("collection"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var got []string
+	var running, maxRunning int32
+	err = it.ForEachParallel(8, func(obj *Object) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		mu.Lock()
+		got = append(got, obj.ID)
+		if n > maxRunning {
+			maxRunning = n
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(got, func(i, j int) bool {
+		a, _ := strconv.Atoi(got[i])
+		b, _ := strconv.Atoi(got[j])
+		return a < b
+	})
+	expectIDs(t, got, 0, 100)
+	if maxRunning < 2 || maxRunning > 8 {
+		t.Errorf("got %d concurrent calls, expecting between 2 and 8", maxRunning)
+	}
+
+	// After an error no more calls are started, except for those that were
+	// already checking for it in other workers.
+	errFoo := errors.New("foo")
+	it, err = cli.Iterator(URL("collection"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failed, late int32
+	err = it.ForEachParallel(4, func(obj *Object) error {
+		if atomic.LoadInt32(&failed) == 1 {
+			atomic.AddInt32(&late, 1)
+		}
+		if obj.ID == "30" {
+			atomic.StoreInt32(&failed, 1)
+			return errFoo
+		}
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if err != errFoo {
+		t.Errorf("got error %v, expecting %v", err, errFoo)
+	}
+	if late > 3 {
+		t.Errorf("%d calls started after the error", late)
+	}
+}
+
+func TestIteratorRetryAfter(t *testing.T) {
+	var requests int32
+	handler := collectionHandler(testObjects(5), 10)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		if r.URL.Query().Get("filter") == "always" || n == 1 {
+			w.Header().Set("Retry-After", r.URL.Query().Get("retry_after"))
+			writeError(w, http.StatusTooManyRequests, "QuotaExceededError")
+			return
+		}
+		handler(w, r)
+	})
+
+	// The first request is rejected, the iterator must wait one second and
+	// retry.
+	start := time.Now()
+	it, err := cli.Iterator(URL("collection?retry_after=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, ids(objs), 0, 5)
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("iterator retried after %v, expecting 1s", elapsed)
+	}
+
+	// With a persistent 429 the error is returned after WithMaxRetries.
+	defer func(d time.Duration) { pageRetryBackoff = d }(pageRetryBackoff)
+	pageRetryBackoff = time.Millisecond
+	atomic.StoreInt32(&requests, 0)
+	it, err = cli.Iterator(URL("collection?retry_after=0"), WithFilter("always"), WithMaxRetries(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.Collect(); err == nil {
+		t.Error("expecting QuotaExceededError")
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("sent %d requests, expecting 3", n)
+	}
+
+	// Closing the iterator interrupts the wait.
+	it, err = cli.Iterator(URL("collection?retry_after=60"), WithFilter("always"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(100*time.Millisecond, it.Close)
+	start = time.Now()
+	it.Next()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("closed iterator kept waiting for %v", elapsed)
+	}
+}
+
+func TestRelationshipIterator(t *testing.T) {
+	var paths []string
+	h := collectionHandler(testObjects(3), 10)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path+"?"+r.URL.RawQuery)
+		h(w, r)
+	})
+	tests := []struct {
+		obj  *Object
+		want string
+	}{
+		{&Object{Type: "domain", ID: "example.com"}, "/api/v3/domains/example.com/resolutions?filter=foo&limit=5"},
+		{&Object{Type: "ip_address", ID: "8.8.8.8"}, "/api/v3/ip_addresses/8.8.8.8/resolutions?filter=foo&limit=5"},
+	}
+	for _, test := range tests {
+		paths = nil
+		it, err := cli.RelationshipIterator(test.obj, "resolutions",
+			WithFilter("foo"), WithBatchSize(5), WithSynchronous(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		objs, err := it.Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, ids(objs), 0, 3)
+		if len(paths) != 1 || paths[0] != test.want {
+			t.Errorf("got requests %v, expecting %s", paths, test.want)
+		}
+	}
+
+	if _, err := cli.RelationshipIterator(&Object{Type: "file"}, "contacted_domains"); err == nil {
+		t.Error("expecting error for object without ID")
+	}
+}
+
+func TestIteratorSeek(t *testing.T) {
+	cli := newTestClient(t, collectionHandler(testObjects(25), 10))
+	for _, options := range [][]IteratorOption{
+		nil,
+		{WithSynchronous(true)},
+		{WithPrefetch(2)},
+	} {
+		it, err := cli.Iterator(URL("files"), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cursor string
+		var got []*Object
+		for it.Next() {
+			got = append(got, it.Get())
+			if it.Get().ID == "12" {
+				cursor = it.Cursor()
+			}
+		}
+		if err := it.Error(); err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, ids(got), 0, 25)
+
+		// Seek after the collection was exhausted.
+		if err := it.Seek(cursor); err != nil {
+			t.Fatal(err)
+		}
+		got = nil
+		for i := 0; i < 5 && it.Next(); i++ {
+			got = append(got, it.Get())
+		}
+		expectIDs(t, ids(got), 13, 18)
+
+		// Reset in the middle of the iteration.
+		if err := it.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		got, err = it.Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, ids(got), 0, 25)
+	}
+}
+
+func TestIteratorHasNext(t *testing.T) {
+	cli := newTestClient(t, collectionHandler(testObjects(25), 10))
+	for _, options := range [][]IteratorOption{nil, {WithSynchronous(true)}} {
+		it, err := cli.Iterator(URL("files"), options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []*Object
+		for it.HasNext() {
+			// HasNext doesn't advance the iterator.
+			if !it.HasNext() {
+				t.Fatal("HasNext returned false after returning true")
+			}
+			if !it.Next() {
+				t.Fatal("Next returned false after HasNext returned true")
+			}
+			got = append(got, it.Get())
+		}
+		if it.Next() {
+			t.Error("Next returned true after HasNext returned false")
+		}
+		if err := it.Error(); err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, ids(got), 0, 25)
+		it.Close()
+	}
+}
+
+func TestIteratorCursorBoundaries(t *testing.T) {
+	const n = 25
+	cli := newTestClient(t, collectionHandler(testObjects(n), 10))
+	it, err := cli.Iterator(URL("files"), WithSynchronous(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cursors []string
+	for it.Next() {
+		cursors = append(cursors, it.Cursor())
+	}
+	// Resuming from the cursor of each object, including the last ones in
+	// each page, must continue right after that object.
+	for i, cursor := range cursors {
+		if cursor == "" {
+			t.Fatalf("empty cursor for object %d", i)
+		}
+		it, err := cli.Iterator(URL("files"), WithCursor(cursor), WithSynchronous(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := it.Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, ids(got), i+1, n)
+	}
+}
+
+func TestWithAttributes(t *testing.T) {
+	full := map[string]interface{}{
+		"size":                1024,
+		"reputation":          -10,
+		"last_analysis_stats": map[string]int{"malicious": 3},
+		"names":               []string{strings.Repeat("x", 1000)},
+	}
+	var written int
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		attrs := full
+		if a := r.URL.Query().Get("attributes"); a != "" {
+			attrs = map[string]interface{}{}
+			for _, name := range strings.Split(a, ",") {
+				attrs[name] = full[name]
+			}
+		}
+		obj := map[string]interface{}{"type": "file", "id": "foo", "attributes": attrs}
+		var data interface{} = obj
+		if r.URL.Path == "/api/v3/files" {
+			data = []interface{}{obj}
+		}
+		b, _ := json.Marshal(data)
+		written = len(b)
+		writeResponse(w, http.StatusOK, map[string]interface{}{"data": data})
+	})
+
+	if _, err := cli.GetObject(URL("files/foo")); err != nil {
+		t.Fatal(err)
+	}
+	fullSize := written
+	obj, err := cli.GetObject(URL("files/foo"),
+		WithRequestAttributes([]string{"last_analysis_stats", "reputation"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(obj.Attributes) != 2 || obj.Attributes["reputation"] == nil {
+		t.Errorf("got attributes %v", obj.Attributes)
+	}
+	if written*4 > fullSize {
+		t.Errorf("got %d bytes with attributes selected, %d without", written, fullSize)
+	}
+
+	it, err := cli.Iterator(URL("files"), WithAttributes([]string{"size"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 || len(objs[0].Attributes) != 1 || objs[0].Attributes["size"] == nil {
+		t.Errorf("got objects %v", objs)
+	}
+
+	if _, err := cli.Iterator(URL("files"), WithAttributes([]string{"size"}),
+		WithDescriptorsOnly(true)); err == nil {
+		t.Error("expecting error for WithAttributes and WithDescriptorsOnly")
+	}
+}
+
+func TestIteratorDescriptor(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("descriptors_only") != "true" {
+			t.Errorf("descriptors_only not set in %s", r.URL)
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": []map[string]interface{}{
+				{"type": "domain", "id": "example.com"},
+				{"type": "domain", "id": "example.org", "context_attributes": map[string]interface{}{"url": "foo"}},
+			}})
+	})
+	it, err := cli.RelationshipIterator(&Object{Type: "file", ID: "foo"}, "contacted_domains",
+		WithDescriptorsOnly(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if d := it.Descriptor(); d.ID != "" {
+		t.Errorf("got descriptor %v before calling Next", d)
+	}
+	var got []ObjectDescriptor
+	for it.Next() {
+		got = append(got, it.Descriptor())
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []ObjectDescriptor{
+		{Type: "domain", ID: "example.com"},
+		{Type: "domain", ID: "example.org", ContextAttributes: map[string]interface{}{"url": "foo"}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got descriptors %v, expecting %v", got, expected)
+	}
+}
+
+func TestIteratorWithChannelBuffer(t *testing.T) {
+	cli := newTestClient(t, collectionHandler(testObjects(25), 10))
+	for _, n := range []int{1, 100} {
+		it, err := cli.Iterator(URL("collection"), WithChannelBuffer(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cap(it.ch) != n {
+			t.Errorf("got channel buffer %d, expecting %d", cap(it.ch), n)
+		}
+		objs, err := it.Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, ids(objs), 0, 25)
+	}
+	if _, err := cli.Iterator(URL("collection"), WithChannelBuffer(0)); err == nil {
+		t.Error("expecting error for empty channel buffer")
+	}
+}
+
+func TestIteratorRelativeNextLink(t *testing.T) {
+	objs := testObjects(25)
+	for _, tc := range []struct {
+		next    string
+		options []ClientOption
+		prefix  string
+	}{
+		{"collection?cursor=10", nil, "/api/v3/"},
+		{"/api/v3/collection?cursor=10", nil, "/api/v3/"},
+		{"collection?cursor=10", []ClientOption{WithBaseURL("https://example.com/vt/api/v3/")}, "/vt/api/v3/"},
+	} {
+		var requested []string
+		cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, r.URL.RequestURI())
+			links := map[string]string{}
+			data := objs[10:]
+			if r.URL.Query().Get("cursor") == "" {
+				links["next"] = tc.next
+				data = objs[:10]
+			}
+			writeResponse(w, http.StatusOK, map[string]interface{}{"data": data, "links": links})
+		}, tc.options...)
+		if tc.options != nil {
+			// The base URL must point to the test server.
+			cli.baseURL.Host = baseURL.Host
+		}
+		it, err := cli.Iterator(URL("collection"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := it.Collect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, ids(got), 0, 25)
+		expected := []string{tc.prefix + "collection", tc.prefix + "collection?cursor=10"}
+		if !reflect.DeepEqual(requested, expected) {
+			t.Errorf("next link %q: got requests %v, expecting %v", tc.next, requested, expected)
+		}
+	}
+}
+
+// serverCursorHandler returns a handler that serves 25 objects in pages of 10
+// objects, which are selected with opaque cursors returned in the metadata.
+// The query of each request is appended to requested.
+func serverCursorHandler(t *testing.T, requested *[]string) http.HandlerFunc {
+	objs := testObjects(25)
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		*requested = append(*requested, q.Encode())
+		pages := map[string]struct {
+			from, to int
+			cursor   string
+		}{
+			"":   {0, 10, "c1"},
+			"c1": {10, 20, "c2"},
+			"c2": {20, 25, ""},
+		}
+		p, ok := pages[q.Get("cursor")]
+		if !ok || q.Get("offset") != "" {
+			writeError(w, http.StatusBadRequest, "BadRequestError")
+			return
+		}
+		meta := map[string]interface{}{}
+		links := map[string]string{}
+		if p.cursor != "" {
+			meta["cursor"] = p.cursor
+			// The next link uses offsets, which must be ignored as the
+			// collection can change between requests.
+			links["next"] = "https://" + r.Host + r.URL.Path + "?offset=" + strconv.Itoa(p.to)
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": objs[p.from:p.to], "meta": meta, "links": links})
+	}
+}
+
+func TestIteratorServerCursor(t *testing.T) {
+	var requested []string
+	cli := newTestClient(t, serverCursorHandler(t, &requested))
+
+	it, err := cli.Iterator(URL("collection"), WithBatchSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, cursors []string
+	for it.Next() {
+		got = append(got, it.Get().ID)
+		cursors = append(cursors, it.Cursor())
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, got, 0, 25)
+	expected := []string{"limit=10", "cursor=c1&limit=10", "cursor=c2&limit=10"}
+	if !reflect.DeepEqual(requested, expected) {
+		t.Errorf("got requests %v, expecting %v", requested, expected)
+	}
+
+	// Resuming from the cursor of an object in the middle of a page requests
+	// that page again with the server cursor.
+	requested = nil
+	it, err = cli.Iterator(URL("collection"), WithCursor(cursors[14]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for it.Next() {
+		got = append(got, it.Get().ID)
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, got, 15, 25)
+	expected = []string{"cursor=c1&limit=10", "cursor=c2&limit=10"}
+	if !reflect.DeepEqual(requested, expected) {
+		t.Errorf("got requests %v, expecting %v", requested, expected)
+	}
+}
+
+func TestIteratorWithServerCursor(t *testing.T) {
+	var requested []string
+	cli := newTestClient(t, serverCursorHandler(t, &requested))
+	it, err := cli.Iterator(URL("collection"), WithBatchSize(10), WithServerCursor(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cursors []string
+	for it.Next() {
+		cursors = append(cursors, it.Cursor())
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if cursors[0] != "" || cursors[9] != "c1" || cursors[10] != "c1" || cursors[19] != "c2" || cursors[24] != "c2" {
+		t.Errorf("got cursors %v", cursors)
+	}
+
+	// The server's cursor is sent as is, along with the other parameters.
+	requested = nil
+	it, err = cli.Iterator(URL("collection"), WithBatchSize(10), WithServerCursor(true), WithCursor("c1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, ids(objs), 10, 25)
+	expected := []string{"cursor=c1&limit=10", "cursor=c2&limit=10"}
+	if !reflect.DeepEqual(requested, expected) {
+		t.Errorf("got requests %v, expecting %v", requested, expected)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+// Logger is the interface used by the client for logging diagnostic messages,
+// like requests being retried, requests waiting for the rate limit or batches
+// missing from a feed. Debugf is used for events that are part of the normal
+// operation of the client, Errorf for errors that the client recovered from.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// WithLogger specifies the logger used by the client, see Logger. By default
+// nothing is logged.
+func WithLogger(logger Logger) ClientOption {
+	return func(cli *Client) {
+		if logger == nil {
+			logger = nopLogger{}
+		}
+		cli.logger = logger
+	}
+}
+
+// nopLogger is a Logger that discards all messages.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
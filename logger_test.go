@@ -0,0 +1,84 @@
+package vt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {
+	l.log("DEBUG " + fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Errorf(format string, args ...interface{}) {
+	l.log("ERROR " + fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) log(msg string) {
+	l.mu.Lock()
+	l.messages = append(l.messages, msg)
+	l.mu.Unlock()
+}
+
+func (l *testLogger) contains(s string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, msg := range l.messages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWithLogger(t *testing.T) {
+	logger := &testLogger{}
+	var requests int32
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/v3/feeds/") ||
+			atomic.AddInt32(&requests, 1) == 1 {
+			writeError(w, http.StatusNotFound, "NotFoundError")
+			return
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{"data": "ok"})
+	}, WithLogger(logger), WithRetry(1),
+		WithRetryBackoff(time.Millisecond, time.Millisecond),
+		WithRetryClassifier(func(resp *http.Response, err error) bool {
+			return err != nil || resp.StatusCode == http.StatusNotFound
+		}))
+
+	if _, err := cli.Get(URL("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if !logger.contains("DEBUG vt: retrying GET") {
+		t.Errorf("retry not logged: %v", logger.messages)
+	}
+
+	f, err := cli.NewFeed("files", WithStartTime(time.Now().Add(-3*time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var missing *MissingBatchError
+	if _, err := f.Next(); !errors.As(err, &missing) {
+		t.Fatalf("got error %v, expecting *MissingBatchError", err)
+	}
+	if !logger.contains("ERROR vt: skipping missing files feed batch") {
+		t.Errorf("missing batch not logged: %v", logger.messages)
+	}
+
+	// Without a logger nothing is logged, and nothing breaks.
+	if _, err := NewClient("apikey", WithLogger(nil)).NewFeed("files"); err != nil {
+		t.Fatal(err)
+	}
+}
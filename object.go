@@ -17,6 +17,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -35,6 +38,9 @@ type Object struct {
 	ContextAttributes map[string]interface{}   `json:"context_attributes,omitempty"`
 	Relationships     map[string]*Relationship `json:"relationships,omitempty"`
 	Links             Links                    `json:"links,omitempty"`
+	// modified contains the names of the attributes modified with the
+	// SetAttribute* functions since the object was retrieved.
+	modified map[string]bool
 }
 
 // Links contains links related to an API object.
@@ -47,6 +53,11 @@ type Links struct {
 type Relationship struct {
 	Data  json.RawMessage `json:"data,omitempty"`
 	Links Links           `json:"links,omitempty"`
+	// Error is not nil if the backend couldn't include the related objects,
+	// for example because there are too many of them. In that case the
+	// related objects must be retrieved from the relationship's endpoint,
+	// see Client.RelationshipIterator.
+	Error *Error `json:"error,omitempty"`
 
 	// IsOneToOne is true if this is a one-to-one relationshio and False if
 	// otherwise. If true RelatedObjects contains one object at most.
@@ -77,8 +88,20 @@ func (obj *Object) UnmarshalJSON(data []byte) error {
 	obj.Attributes = o.Attributes
 	obj.ContextAttributes = o.ContextAttributes
 	obj.Relationships = o.Relationships
+	obj.Links = o.Links
+	obj.modified = nil
 
 	for _, v := range obj.Relationships {
+		// Relationships that couldn't be included have an error and no data.
+		if v.Error != nil && len(v.Data) == 0 {
+			continue
+		}
+		// Keep the relationship's data compacted, so that the object is the
+		// same regardless of the formatting of the JSON it came from.
+		var b bytes.Buffer
+		if err := json.Compact(&b, v.Data); err == nil {
+			v.Data = b.Bytes()
+		}
 		// Try unmarshalling as an array first, if it fails this is a one-to-one
 		// relationship, so we should try unmarshalling a single object descriptor.
 		if err := json.Unmarshal(v.Data, &v.RelatedObjects); err != nil {
@@ -94,9 +117,77 @@ func (obj *Object) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// toNumber converts v to a json.Number. Attributes decoded by UnmarshalJSON
+// are already json.Number, but attributes set by the user, or decoded without
+// UseNumber, can be float64 or other numeric types.
+func toNumber(v interface{}) (json.Number, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return n, true
+	case float64:
+		return json.Number(strconv.FormatFloat(n, 'f', -1, 64)), true
+	case float32:
+		return json.Number(strconv.FormatFloat(float64(n), 'f', -1, 32)), true
+	case int:
+		return json.Number(strconv.Itoa(n)), true
+	case int64:
+		return json.Number(strconv.FormatInt(n, 10)), true
+	}
+	return "", false
+}
+
+// MarshalJSON marshals a VirusTotal API object into JSON, producing the same
+// JSON structure returned by the API. Objects marshalled with this function
+// can be unmarshalled with UnmarshalJSON, obtaining an identical object.
+func (obj Object) MarshalJSON() ([]byte, error) {
+	type relationship struct {
+		Data  json.RawMessage `json:"data,omitempty"`
+		Links *Links          `json:"links,omitempty"`
+		Error *Error          `json:"error,omitempty"`
+	}
+	o := struct {
+		ID                string                   `json:"id,omitempty"`
+		Type              string                   `json:"type,omitempty"`
+		Attributes        map[string]interface{}   `json:"attributes,omitempty"`
+		ContextAttributes map[string]interface{}   `json:"context_attributes,omitempty"`
+		Relationships     map[string]*relationship `json:"relationships,omitempty"`
+		Links             *Links                   `json:"links,omitempty"`
+	}{
+		ID:                obj.ID,
+		Type:              obj.Type,
+		Attributes:        obj.Attributes,
+		ContextAttributes: obj.ContextAttributes,
+	}
+	if obj.Links != (Links{}) {
+		o.Links = &obj.Links
+	}
+	if len(obj.Relationships) > 0 {
+		o.Relationships = make(map[string]*relationship, len(obj.Relationships))
+	}
+	for name, v := range obj.Relationships {
+		r := &relationship{Data: v.Data, Error: v.Error}
+		if v.Links != (Links{}) {
+			r.Links = &v.Links
+		}
+		// Relationships created by hand may have only the related objects.
+		if len(r.Data) == 0 && r.Error == nil {
+			var err error
+			var data interface{} = v.RelatedObjects
+			if v.IsOneToOne && len(v.RelatedObjects) > 0 {
+				data = v.RelatedObjects[0]
+			}
+			if r.Data, err = json.Marshal(data); err != nil {
+				return nil, err
+			}
+		}
+		o.Relationships[name] = r
+	}
+	return json.Marshal(o)
+}
+
 func (obj *Object) getAttributeNumber(name string) (n json.Number, err error) {
 	if attrValue, attrExists := obj.Attributes[name]; attrExists {
-		n, isNumber := attrValue.(json.Number)
+		n, isNumber := toNumber(attrValue)
 		if !isNumber {
 			err = fmt.Errorf("attribute \"%s\" is not a number", name)
 		}
@@ -107,7 +198,7 @@ func (obj *Object) getAttributeNumber(name string) (n json.Number, err error) {
 
 func (obj *Object) getContextAttributeNumber(name string) (n json.Number, err error) {
 	if attrValue, attrExists := obj.ContextAttributes[name]; attrExists {
-		n, isNumber := attrValue.(json.Number)
+		n, isNumber := toNumber(attrValue)
 		if !isNumber {
 			err = fmt.Errorf("context attribute \"%s\" is not a number", name)
 		}
@@ -149,6 +240,19 @@ func (obj *Object) GetAttributeString(name string) (s string, err error) {
 	return "", fmt.Errorf("attribute \"%s\" does not exists", name)
 }
 
+// GetAttributeBool returns an attribute as a bool. It returns an error if the
+// attribute doesn't exist or is not a boolean.
+func (obj *Object) GetAttributeBool(name string) (b bool, err error) {
+	if attrValue, attrExists := obj.Attributes[name]; attrExists {
+		b, isBool := attrValue.(bool)
+		if !isBool {
+			err = fmt.Errorf("attribute \"%s\" is not a bool", name)
+		}
+		return b, err
+	}
+	return false, fmt.Errorf("attribute \"%s\" does not exists", name)
+}
+
 // GetAttributeTime returns an attribute as a time. It returns the attribute's
 // value and a boolean indicating that the attribute exists and is a time.
 func (obj *Object) GetAttributeTime(name string) (t time.Time, err error) {
@@ -160,6 +264,203 @@ func (obj *Object) GetAttributeTime(name string) (t time.Time, err error) {
 	return time.Unix(0, 0), err
 }
 
+// GetRelationship returns the relationship with the given name. It returns an
+// error if the object doesn't have the relationship, which happens when the
+// relationship was not requested, and also if the backend couldn't include
+// the related objects in the response, for example because there are too many
+// of them. In the latter case the error is the one returned by
+// RelationshipError.
+func (obj *Object) GetRelationship(name string) (*Relationship, error) {
+	r, exists := obj.Relationships[name]
+	if !exists {
+		return nil, fmt.Errorf("relationship \"%s\" does not exists", name)
+	}
+	if r.Error != nil {
+		return nil, *r.Error
+	}
+	return r, nil
+}
+
+// Relationship returns the objects related to this one through the
+// relationship with the given name, as included by the backend when the
+// object is retrieved with Client.GetObjectWithRelationships. The related
+// objects contain only their type and ID, unless the backend included some of
+// their attributes too. It returns nil if the object doesn't have the
+// relationship or if the backend couldn't include it, see RelationshipError.
+func (obj *Object) Relationship(name string) []*Object {
+	r, exists := obj.Relationships[name]
+	if !exists || r.Error != nil {
+		return nil
+	}
+	var objs []*Object
+	if len(r.Data) == 0 {
+		// Relationships created by hand may have only the descriptors.
+		for _, d := range r.RelatedObjects {
+			objs = append(objs, &Object{ID: d.ID, Type: d.Type, ContextAttributes: d.ContextAttributes})
+		}
+		return objs
+	}
+	if r.IsOneToOne {
+		o := &Object{}
+		if err := json.Unmarshal(r.Data, o); err != nil || o.ID == "" {
+			return nil
+		}
+		return []*Object{o}
+	}
+	if err := json.Unmarshal(r.Data, &objs); err != nil {
+		return nil
+	}
+	return objs
+}
+
+// RelationshipError returns the error returned by the backend for the
+// relationship with the given name instead of the related objects, which
+// usually means that the relationship was omitted due to its size and it must
+// be retrieved from its own endpoint with Client.RelationshipIterator. It
+// returns nil if the relationship doesn't have an error, including when the
+// object doesn't have the relationship at all.
+func (obj *Object) RelationshipError(name string) error {
+	if r, exists := obj.Relationships[name]; exists && r.Error != nil {
+		return *r.Error
+	}
+	return nil
+}
+
+// Get returns the value found by following a dotted path through the object's
+// attributes, like "last_analysis_results.Kaspersky.category". Each segment
+// of the path is a key in a nested map, or an index in a nested array, like
+// in "pe_info.sections.0.name". The error indicates which segment of the path
+// was not found or was not a map or array.
+func (obj *Object) Get(path string) (interface{}, error) {
+	var v interface{} = obj.Attributes
+	segments := strings.Split(path, ".")
+	for i, segment := range segments {
+		prefix := strings.Join(segments[:i+1], ".")
+		switch container := v.(type) {
+		case map[string]interface{}:
+			value, exists := container[segment]
+			if !exists {
+				return nil, fmt.Errorf("attribute \"%s\" does not exists", prefix)
+			}
+			v = value
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(container) {
+				return nil, fmt.Errorf("attribute \"%s\" does not exists", prefix)
+			}
+			v = container[index]
+		default:
+			return nil, fmt.Errorf("attribute \"%s\" is not a map or array",
+				strings.Join(segments[:i], "."))
+		}
+	}
+	return v, nil
+}
+
+// GetStringAt is like Get, but returns an error if the value is not a string.
+func (obj *Object) GetStringAt(path string) (string, error) {
+	v, err := obj.Get(path)
+	if err != nil {
+		return "", err
+	}
+	s, isString := v.(string)
+	if !isString {
+		return "", fmt.Errorf("attribute \"%s\" is not a string", path)
+	}
+	return s, nil
+}
+
+// GetIntAt is like Get, but returns an error if the value is not an integer.
+func (obj *Object) GetIntAt(path string) (int64, error) {
+	v, err := obj.Get(path)
+	if err != nil {
+		return 0, err
+	}
+	n, isNumber := toNumber(v)
+	if !isNumber {
+		return 0, fmt.Errorf("attribute \"%s\" is not a number", path)
+	}
+	return n.Int64()
+}
+
+// SetAttribute sets the value of an attribute and marks it as modified, so
+// that it's sent to VirusTotal when the object is updated with
+// Client.PatchObject.
+func (obj *Object) SetAttribute(name string, value interface{}) {
+	if obj.Attributes == nil {
+		obj.Attributes = make(map[string]interface{})
+	}
+	if obj.modified == nil {
+		obj.modified = make(map[string]bool)
+	}
+	obj.Attributes[name] = value
+	obj.modified[name] = true
+}
+
+// SetAttributeString sets a string attribute, see SetAttribute.
+func (obj *Object) SetAttributeString(name, value string) {
+	obj.SetAttribute(name, value)
+}
+
+// SetAttributeInt64 sets an integer attribute, see SetAttribute.
+func (obj *Object) SetAttributeInt64(name string, value int64) {
+	obj.SetAttribute(name, json.Number(strconv.FormatInt(value, 10)))
+}
+
+// SetAttributeBool sets a boolean attribute, see SetAttribute.
+func (obj *Object) SetAttributeBool(name string, value bool) {
+	obj.SetAttribute(name, value)
+}
+
+// IsModified returns true if some of the object's attributes were modified
+// with the SetAttribute* functions and haven't been sent to VirusTotal yet.
+func (obj *Object) IsModified() bool {
+	return len(obj.modified) > 0
+}
+
+// collectionPaths maps object types to the path of the collection containing
+// them, for those types where the path is not simply the type plus "s".
+var collectionPaths = map[string]string{
+	"analysis":             "analyses",
+	"ip_address":           "ip_addresses",
+	"hunting_ruleset":      "intelligence/hunting_rulesets",
+	"hunting_notification": "intelligence/hunting_notifications",
+	"retrohunt_job":        "intelligence/retrohunt_jobs",
+}
+
+// objectURL returns the URL of an object, derived from its type and ID, which
+// must not be empty.
+func objectURL(obj *Object) (*url.URL, error) {
+	collection, err := objectCollection(obj)
+	if err != nil {
+		return nil, err
+	}
+	return ObjectURL(collection, obj.ID), nil
+}
+
+// objectCollection returns the path of the collection to which an object
+// belongs, derived from its type. The object's type and ID must not be empty.
+func objectCollection(obj *Object) (string, error) {
+	if obj.Type == "" || obj.ID == "" {
+		return "", fmt.Errorf("object must have a type and an ID")
+	}
+	collection, ok := collectionPaths[obj.Type]
+	if !ok {
+		collection = obj.Type + "s"
+	}
+	return collection, nil
+}
+
+// modifiedObject returns an object with the same type and ID as obj, but only
+// the modified attributes.
+func (obj *Object) modifiedObject() *Object {
+	o := &Object{Type: obj.Type, ID: obj.ID, Attributes: make(map[string]interface{})}
+	for name := range obj.modified {
+		o.Attributes[name] = obj.Attributes[name]
+	}
+	return o
+}
+
 // GetContextAttributeInt64 returns a context attribute as an int64. It returns
 // the attribute's value and a boolean indicating that the context attribute
 // exists and is a number.
@@ -182,6 +483,19 @@ func (obj *Object) GetContextAttributeFloat64(name string) (float64, error) {
 	return 0, err
 }
 
+// GetContextAttributeBool returns a context attribute as a bool. It returns
+// an error if the context attribute doesn't exist or is not a boolean.
+func (obj *Object) GetContextAttributeBool(name string) (b bool, err error) {
+	if attrValue, attrExists := obj.ContextAttributes[name]; attrExists {
+		b, isBool := attrValue.(bool)
+		if !isBool {
+			err = fmt.Errorf("context attribute \"%s\" is not a bool", name)
+		}
+		return b, err
+	}
+	return false, fmt.Errorf("context attribute \"%s\" does not exists", name)
+}
+
 // GetContextAttributeString returns a context attribute as a string. It returns
 // the attribute's svalue and a boolean indicating that the context attribute
 // exists and is a string.
@@ -192,3 +506,34 @@ func (obj *Object) GetContextAttributeString(name string) (string, bool) {
 	}
 	return "", false
 }
+
+// UnmarshalAttributes unmarshals the object's attributes into v, which is
+// usually a pointer to a struct with the appropriate json tags. This is
+// useful for getting many attributes at once, instead of one by one with
+// GetAttributeString, GetAttributeInt64, etc. It returns an error if the
+// object doesn't have attributes.
+func (obj *Object) UnmarshalAttributes(v interface{}) error {
+	if len(obj.Attributes) == 0 {
+		return fmt.Errorf("object doesn't have attributes")
+	}
+	return unmarshalMap(obj.Attributes, v)
+}
+
+// UnmarshalContextAttributes is like UnmarshalAttributes, but unmarshals the
+// object's context attributes.
+func (obj *Object) UnmarshalContextAttributes(v interface{}) error {
+	if len(obj.ContextAttributes) == 0 {
+		return fmt.Errorf("object doesn't have context attributes")
+	}
+	return unmarshalMap(obj.ContextAttributes, v)
+}
+
+// unmarshalMap unmarshals m into v by encoding it as JSON and decoding it
+// again.
+func unmarshalMap(m map[string]interface{}, v interface{}) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,314 @@
+package vt
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestObjectTypedGetters(t *testing.T) {
+	obj := &Object{}
+	if err := json.Unmarshal([]byte(`{
+	  "type": "file",
+	  "id": "foo",
+	  "attributes": {
+	    "size": 1024,
+	    "ratio": 0.25,
+	    "name": "foo.exe",
+	    "signed": true
+	  },
+	  "context_attributes": {"confirmed": false}
+	}`), obj); err != nil {
+		t.Fatal(err)
+	}
+
+	if f, err := obj.GetAttributeFloat64("ratio"); err != nil || f != 0.25 {
+		t.Errorf("got ratio %v, %v", f, err)
+	}
+	if b, err := obj.GetAttributeBool("signed"); err != nil || !b {
+		t.Errorf("got signed %v, %v", b, err)
+	}
+	if b, err := obj.GetContextAttributeBool("confirmed"); err != nil || b {
+		t.Errorf("got confirmed %v, %v", b, err)
+	}
+
+	// Missing and wrong-type attributes.
+	if _, err := obj.GetAttributeFloat64("missing"); err == nil {
+		t.Error("expecting error for missing attribute")
+	}
+	if _, err := obj.GetAttributeFloat64("name"); err == nil {
+		t.Error("expecting error for string attribute")
+	}
+	if _, err := obj.GetAttributeBool("missing"); err == nil {
+		t.Error("expecting error for missing attribute")
+	}
+	if _, err := obj.GetAttributeBool("size"); err == nil {
+		t.Error("expecting error for number attribute")
+	}
+	if _, err := obj.GetContextAttributeBool("missing"); err == nil {
+		t.Error("expecting error for missing context attribute")
+	}
+	if _, err := obj.GetAttributeInt64("ratio"); err == nil {
+		t.Error("expecting error for fractional attribute")
+	}
+}
+
+func TestObjectRelationshipError(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/domain_truncated.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := &Object{}
+	if err := json.Unmarshal(b, obj); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := obj.GetRelationship("subdomains")
+	if err != nil || len(r.RelatedObjects) != 1 || r.RelatedObjects[0].ID != "www.example.com" {
+		t.Errorf("got subdomains %+v, %v", r, err)
+	}
+	if err := obj.RelationshipError("subdomains"); err != nil {
+		t.Errorf("got error %v for subdomains", err)
+	}
+
+	err = obj.RelationshipError("resolutions")
+	if apiErr, ok := err.(Error); !ok || apiErr.Code != "TooManyRelatedObjectsError" {
+		t.Errorf("got error %#v for resolutions", err)
+	}
+	if _, err := obj.GetRelationship("resolutions"); err == nil || err.Error() != obj.RelationshipError("resolutions").Error() {
+		t.Errorf("got error %v for resolutions", err)
+	}
+
+	// Absent relationships don't have an error, but can't be obtained.
+	if err := obj.RelationshipError("siblings"); err != nil {
+		t.Errorf("got error %v for absent relationship", err)
+	}
+	if _, err := obj.GetRelationship("siblings"); err == nil {
+		t.Error("expecting error for absent relationship")
+	}
+
+	// The error is kept when the object is marshalled again.
+	b, err = json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &Object{}
+	if err := json.Unmarshal(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.RelationshipError("resolutions"), obj.RelationshipError("resolutions")) {
+		t.Errorf("got error %v after marshalling", got.RelationshipError("resolutions"))
+	}
+}
+
+func TestObjectGetPath(t *testing.T) {
+	obj := &Object{}
+	if err := json.Unmarshal([]byte(`{
+	  "type": "file",
+	  "id": "foo",
+	  "attributes": {
+	    "last_analysis_results": {"Kaspersky": {"category": "malicious"}},
+	    "pe_info": {"sections": [{"name": ".text", "raw_size": 4096}]}
+	  }
+	}`), obj); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := obj.GetStringAt("last_analysis_results.Kaspersky.category"); err != nil || s != "malicious" {
+		t.Errorf("got category %q, %v", s, err)
+	}
+	if s, err := obj.GetStringAt("pe_info.sections.0.name"); err != nil || s != ".text" {
+		t.Errorf("got section name %q, %v", s, err)
+	}
+	if n, err := obj.GetIntAt("pe_info.sections.0.raw_size"); err != nil || n != 4096 {
+		t.Errorf("got section size %d, %v", n, err)
+	}
+	if v, err := obj.Get("pe_info.sections"); err != nil || len(v.([]interface{})) != 1 {
+		t.Errorf("got sections %v, %v", v, err)
+	}
+
+	for path, expected := range map[string]string{
+		"last_analysis_results.McAfee.category":      `attribute "last_analysis_results.McAfee" does not exists`,
+		"pe_info.sections.1.name":                    `attribute "pe_info.sections.1" does not exists`,
+		"pe_info.sections.first":                     `attribute "pe_info.sections.first" does not exists`,
+		"pe_info.sections.0.name.length":             `attribute "pe_info.sections.0.name" is not a map or array`,
+		"last_analysis_results.Kaspersky.category.x": `attribute "last_analysis_results.Kaspersky.category" is not a map or array`,
+	} {
+		if _, err := obj.Get(path); err == nil || err.Error() != expected {
+			t.Errorf("got error %v for %s, expecting %s", err, path, expected)
+		}
+	}
+	if _, err := obj.GetIntAt("pe_info.sections.0.name"); err == nil {
+		t.Error("expecting error for string attribute")
+	}
+	if _, err := obj.GetStringAt("pe_info.sections.0.raw_size"); err == nil {
+		t.Error("expecting error for number attribute")
+	}
+}
+
+func TestObjectGetAttributeInt64FromFloat(t *testing.T) {
+	obj := NewObject()
+	obj.Attributes["size"] = float64(1024)
+	obj.Attributes["count"] = 7
+	if n, err := obj.GetAttributeInt64("size"); err != nil || n != 1024 {
+		t.Errorf("got size %v, %v", n, err)
+	}
+	if n, err := obj.GetAttributeInt64("count"); err != nil || n != 7 {
+		t.Errorf("got count %v, %v", n, err)
+	}
+	if f, err := obj.GetAttributeFloat64("count"); err != nil || f != 7 {
+		t.Errorf("got count %v, %v", f, err)
+	}
+}
+
+func TestObjectUnmarshalAttributes(t *testing.T) {
+	obj := &Object{}
+	if err := json.Unmarshal([]byte(`{
+	  "type": "file",
+	  "id": "foo",
+	  "attributes": {
+	    "size": 1024,
+	    "names": ["foo.exe", "bar.exe"],
+	    "last_analysis_stats": {"malicious": 3}
+	  },
+	  "context_attributes": {"rule_name": "foo"}
+	}`), obj); err != nil {
+		t.Fatal(err)
+	}
+
+	var attrs struct {
+		Size  int64    `json:"size"`
+		Names []string `json:"names"`
+		Stats struct {
+			Malicious int `json:"malicious"`
+		} `json:"last_analysis_stats"`
+	}
+	if err := obj.UnmarshalAttributes(&attrs); err != nil {
+		t.Fatal(err)
+	}
+	if attrs.Size != 1024 || len(attrs.Names) != 2 || attrs.Stats.Malicious != 3 {
+		t.Errorf("unexpected attributes: %+v", attrs)
+	}
+	if _, ok := obj.Attributes["size"].(json.Number); !ok {
+		t.Error("object's attributes were modified")
+	}
+
+	var ctxAttrs struct {
+		RuleName string `json:"rule_name"`
+	}
+	if err := obj.UnmarshalContextAttributes(&ctxAttrs); err != nil {
+		t.Fatal(err)
+	}
+	if ctxAttrs.RuleName != "foo" {
+		t.Errorf("got rule name %q, expecting \"foo\"", ctxAttrs.RuleName)
+	}
+
+	if err := (&Object{}).UnmarshalAttributes(&attrs); err == nil {
+		t.Error("expecting error for object without attributes")
+	}
+	if err := (&Object{}).UnmarshalContextAttributes(&ctxAttrs); err == nil {
+		t.Error("expecting error for object without context attributes")
+	}
+}
+
+func TestPatchModifiedObject(t *testing.T) {
+	var sent map[string]interface{}
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" || r.URL.Path != "/api/v3/intelligence/hunting_rulesets/1234" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		var req struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		sent = req.Data
+		writeResponse(w, http.StatusOK, req)
+	})
+
+	obj := &Object{}
+	if err := json.Unmarshal([]byte(`{
+	  "type": "hunting_ruleset",
+	  "id": "1234",
+	  "attributes": {"name": "foo", "enabled": true, "limit": 100}
+	}`), obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.IsModified() {
+		t.Error("object is modified after unmarshalling")
+	}
+	obj.SetAttributeBool("enabled", false)
+	obj.SetAttributeInt64("limit", 200)
+	if !obj.IsModified() {
+		t.Error("object is not modified after setting attributes")
+	}
+	if err := cli.PatchObject(nil, obj); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"type":       "hunting_ruleset",
+		"id":         "1234",
+		"attributes": map[string]interface{}{"enabled": false, "limit": float64(200)},
+	}
+	delete(sent, "links")
+	if !reflect.DeepEqual(sent, expected) {
+		t.Errorf("sent %v, expecting %v", sent, expected)
+	}
+	if obj.IsModified() {
+		t.Error("object is modified after patching")
+	}
+	if err := cli.PatchObject(nil, &Object{Type: "file"}); err == nil {
+		t.Error("expecting error for object without ID")
+	}
+}
+
+func TestObjectJSONRoundTrip(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/file.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := &Object{}
+	if err := json.Unmarshal(b, obj); err != nil {
+		t.Fatal(err)
+	}
+	if len(obj.Relationships) != 2 || !obj.Relationships["itw_url"].IsOneToOne {
+		t.Fatalf("unexpected relationships: %v", obj.Relationships)
+	}
+
+	b, err = json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &Object{}
+	if err := json.Unmarshal(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, obj) {
+		t.Errorf("object changed after round trip:\n%s", b)
+	}
+
+	// Relationships created without data are marshalled from their related
+	// objects.
+	obj = NewObject()
+	obj.Type, obj.ID = "file", "foo"
+	obj.Relationships = map[string]*Relationship{
+		"bundled_files": {RelatedObjects: []ObjectDescriptor{{Type: "file", ID: "bar"}}},
+		"itw_url":       {IsOneToOne: true, RelatedObjects: []ObjectDescriptor{{Type: "url", ID: "baz"}}},
+	}
+	if b, err = json.Marshal(obj); err != nil {
+		t.Fatal(err)
+	}
+	got = &Object{}
+	if err := json.Unmarshal(b, got); err != nil {
+		t.Fatal(err)
+	}
+	for name, r := range obj.Relationships {
+		if g := got.Relationships[name]; g == nil || g.IsOneToOne != r.IsOneToOne ||
+			!reflect.DeepEqual(g.RelatedObjects, r.RelatedObjects) {
+			t.Errorf("relationship %s changed after round trip: %+v", name, g)
+		}
+	}
+}
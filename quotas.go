@@ -0,0 +1,80 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import (
+	"net/url"
+	"time"
+)
+
+// QuotaUsage contains the number of requests allowed by a quota and the
+// number of requests already used.
+type QuotaUsage struct {
+	Allowed int64 `json:"allowed"`
+	Used    int64 `json:"used"`
+	// InheritedFrom is the group from which the quota is inherited, if any.
+	InheritedFrom string `json:"inherited_from"`
+}
+
+// Remaining returns the number of requests that can be made before
+// exhausting the quota, which is never negative.
+func (q QuotaUsage) Remaining() int64 {
+	if q.Used >= q.Allowed {
+		return 0
+	}
+	return q.Allowed - q.Used
+}
+
+// Quota describes a quota as it applies to the user and to the group the user
+// belongs to. Group is zero if the user doesn't belong to a group.
+type Quota struct {
+	User  QuotaUsage `json:"user"`
+	Group QuotaUsage `json:"group"`
+	// Reset is the time at which the quota is reset. Quotas are reset at the
+	// beginning of every hour, day or month (in UTC) depending on the
+	// quota's period. It's zero for quotas that don't depend on time.
+	Reset time.Time `json:"-"`
+}
+
+// Quotas contains the quotas returned by the /users/{id}/overall_quotas
+// endpoint.
+type Quotas struct {
+	APIRequestsHourly                Quota `json:"api_requests_hourly"`
+	APIRequestsDaily                 Quota `json:"api_requests_daily"`
+	APIRequestsMonthly               Quota `json:"api_requests_monthly"`
+	IntelligenceSearchesMonthly      Quota `json:"intelligence_searches_monthly"`
+	IntelligenceDownloadsMonthly     Quota `json:"intelligence_downloads_monthly"`
+	IntelligenceRetrohuntJobsMonthly Quota `json:"intelligence_retrohunt_jobs_monthly"`
+	IntelligenceHuntingRules         Quota `json:"intelligence_hunting_rules"`
+}
+
+// Quotas returns the quotas of the user identified by the client's API key,
+// and how much of them has been used already.
+func (cli *Client) Quotas() (*Quotas, error) {
+	quotas := &Quotas{}
+	if _, err := cli.GetData(URL("users/%s/overall_quotas", url.PathEscape(cli.APIKey)), quotas); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	hour := now.Truncate(time.Hour).Add(time.Hour)
+	day := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	quotas.APIRequestsHourly.Reset = hour
+	quotas.APIRequestsDaily.Reset = day
+	quotas.APIRequestsMonthly.Reset = month
+	quotas.IntelligenceSearchesMonthly.Reset = month
+	quotas.IntelligenceDownloadsMonthly.Reset = month
+	quotas.IntelligenceRetrohuntJobsMonthly.Reset = month
+	return quotas, nil
+}
@@ -0,0 +1,57 @@
+package vt
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuotas(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/users/apikey/overall_quotas" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]interface{}{
+				"api_requests_daily": map[string]interface{}{
+					"user":  map[string]interface{}{"allowed": 500, "used": 20},
+					"group": map[string]interface{}{"allowed": 1000, "used": 1200, "inherited_from": "acme"},
+				},
+				"intelligence_hunting_rules": map[string]interface{}{
+					"user": map[string]interface{}{"allowed": 10, "used": 3},
+				},
+			}})
+	})
+	quotas, err := cli.Quotas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily := quotas.APIRequestsDaily
+	if daily.User.Allowed != 500 || daily.User.Used != 20 || daily.User.Remaining() != 480 {
+		t.Errorf("unexpected user quota: %+v", daily.User)
+	}
+	if daily.Group.InheritedFrom != "acme" || daily.Group.Remaining() != 0 {
+		t.Errorf("unexpected group quota: %+v", daily.Group)
+	}
+	if d := time.Until(daily.Reset); d <= 0 || d > 24*time.Hour {
+		t.Errorf("daily quota is reset at %v", daily.Reset)
+	}
+	if r := quotas.IntelligenceHuntingRules; r.User.Remaining() != 7 || !r.Reset.IsZero() {
+		t.Errorf("unexpected hunting rules quota: %+v", r)
+	}
+}
+
+func TestQuotasEscapesAPIKey(t *testing.T) {
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v3/users/api%2Fkey%3F/overall_quotas" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.EscapedPath())
+		}
+		http.Error(w, "oops", http.StatusInternalServerError)
+	})
+	cli.APIKey = "api/key?"
+	_, err := cli.Quotas()
+	if err == nil || strings.Contains(err.Error(), "api/key") || strings.Contains(err.Error(), "api%2Fkey") {
+		t.Errorf("got error %v, expecting error without the API key", err)
+	}
+}
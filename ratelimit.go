@@ -0,0 +1,145 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket that holds up to burst tokens and is refilled
+// with one token every interval.
+type rateLimiter struct {
+	mu       sync.Mutex
+	tokens   float64
+	burst    float64
+	interval time.Duration
+	last     time.Time
+}
+
+// newRateLimiter returns a rateLimiter that allows perMinute requests per
+// minute. The bucket starts full, so up to perMinute requests can be sent
+// right away.
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		tokens:   float64(perMinute),
+		burst:    float64(perMinute),
+		interval: time.Minute / time.Duration(perMinute),
+		last:     time.Now(),
+	}
+}
+
+// refill adds the tokens accumulated since the last refill. The caller must
+// hold l.mu.
+func (l *rateLimiter) refill() {
+	now := time.Now()
+	l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+// available returns the number of tokens currently in the bucket.
+func (l *rateLimiter) available() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	return int(l.tokens)
+}
+
+// refund returns a token taken by wait to the bucket, for requests that
+// shouldn't count towards the limit.
+func (l *rateLimiter) refund() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	l.tokens++
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// wait takes a token from the bucket, blocking until one is available or the
+// context is cancelled.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		l.refill()
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		d := time.Duration((1 - l.tokens) * float64(l.interval))
+		l.mu.Unlock()
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// drain removes all the tokens from the bucket, so that requests are sent at
+// the bucket's steady rate from now on, without bursts.
+func (l *rateLimiter) drain() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill()
+	if l.tokens > 0 {
+		l.tokens = 0
+	}
+}
+
+// pauseGate holds requests until a given time. It's shared by all requests
+// sent by a client, so that when the backend asks to slow down with a 429
+// response all of them wait, instead of each one backing off independently.
+type pauseGate struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// pause holds requests for d from now, unless they were already held for
+// longer.
+func (g *pauseGate) pause(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if until := time.Now().Add(d); until.After(g.until) {
+		g.until = until
+	}
+}
+
+// wait blocks until requests are not held anymore, or the context is
+// cancelled.
+func (g *pauseGate) wait(ctx context.Context) error {
+	for {
+		g.mu.Lock()
+		d := time.Until(g.until)
+		g.mu.Unlock()
+		if d <= 0 {
+			return nil
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
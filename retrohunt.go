@@ -0,0 +1,91 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import (
+	"context"
+	"time"
+)
+
+// defaultRetrohuntPollInterval is the interval used by WaitForRetrohunt when
+// none is specified. Retrohunt jobs take minutes or hours to complete, there's
+// no point in polling them more often.
+const defaultRetrohuntPollInterval = time.Minute
+
+// RetrohuntOption represents an option passed to Client.StartRetrohunt.
+type RetrohuntOption func(*Object)
+
+// WithRetrohuntTimeRange limits the retrohunt job to the files submitted to
+// VirusTotal between start and end. A zero time leaves that end of the range
+// open, using the backend's default.
+func WithRetrohuntTimeRange(start, end time.Time) RetrohuntOption {
+	return func(job *Object) {
+		timeRange := map[string]interface{}{}
+		if !start.IsZero() {
+			timeRange["start"] = start.Unix()
+		}
+		if !end.IsZero() {
+			timeRange["end"] = end.Unix()
+		}
+		job.Attributes["time_range"] = timeRange
+	}
+}
+
+// WithRetrohuntCorpus specifies the corpus scanned by the retrohunt job, like
+// "main" or "goodware". By default the main corpus is scanned.
+func WithRetrohuntCorpus(corpus string) RetrohuntOption {
+	return func(job *Object) {
+		job.Attributes["corpus"] = corpus
+	}
+}
+
+// StartRetrohunt starts a retrohunt job that scans VirusTotal's file corpus
+// with the given YARA rules, and returns the newly created job. Use
+// WaitForRetrohunt for waiting until the job finishes, and RetrohuntMatches
+// for iterating over the matching files.
+func (cli *Client) StartRetrohunt(yara string, options ...RetrohuntOption) (*Object, error) {
+	job := NewObject()
+	job.Type = "retrohunt_job"
+	job.Attributes["rules"] = yara
+	for _, opt := range options {
+		opt(job)
+	}
+	if err := cli.CreateObject(URL("intelligence/retrohunt_jobs"), job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// WaitForRetrohunt polls the retrohunt job with the given ID until its status
+// is "finished" or "aborted", or the context is cancelled, and returns the job.
+// The caller should check the job's status for telling apart finished and
+// aborted jobs. The job is requested every interval, or every minute if
+// interval is zero.
+func (cli *Client) WaitForRetrohunt(ctx context.Context, id string, interval time.Duration) (*Object, error) {
+	if interval <= 0 {
+		interval = defaultRetrohuntPollInterval
+	}
+	return cli.pollObject(ctx, URL("intelligence/retrohunt_jobs/%s", id), interval,
+		func(job *Object) (bool, error) {
+			status, _ := job.GetAttributeString("status")
+			return status == "finished" || status == "aborted", nil
+		})
+}
+
+// RetrohuntMatches returns an iterator over the files matched by the retrohunt
+// job with the given ID. Retrohunt jobs can match a huge number of files, use
+// WithLimit for limiting the number of files returned by the iterator.
+func (cli *Client) RetrohuntMatches(jobID string, options ...IteratorOption) (*Iterator, error) {
+	return cli.Iterator(URL("intelligence/retrohunt_jobs/%s/matching_files", jobID), options...)
+}
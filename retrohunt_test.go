@@ -0,0 +1,82 @@
+package vt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetrohunt(t *testing.T) {
+	var sent map[string]interface{}
+	polls := 0
+	matches := collectionHandler(testObjects(50), 10)
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/v3/intelligence/retrohunt_jobs":
+			var req struct {
+				Data struct {
+					Attributes map[string]interface{} `json:"attributes"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			sent = req.Data.Attributes
+			writeResponse(w, http.StatusOK, map[string]interface{}{
+				"data": map[string]interface{}{
+					"type": "retrohunt_job", "id": "job",
+					"attributes": map[string]interface{}{"status": "starting"}}})
+		case r.Method == "GET" && r.URL.Path == "/api/v3/intelligence/retrohunt_jobs/job":
+			polls++
+			status := "running"
+			if polls == 3 {
+				status = "finished"
+			}
+			writeResponse(w, http.StatusOK, map[string]interface{}{
+				"data": map[string]interface{}{
+					"type": "retrohunt_job", "id": "job",
+					"attributes": map[string]interface{}{"status": status}}})
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/retrohunt_jobs/job/matching_files"):
+			matches(w, r)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		}
+	})
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	job, err := cli.StartRetrohunt("rule foo { condition: true }",
+		WithRetrohuntTimeRange(start, time.Time{}),
+		WithRetrohuntCorpus("goodware"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != "job" {
+		t.Errorf("got job %q", job.ID)
+	}
+	timeRange, _ := sent["time_range"].(map[string]interface{})
+	if sent["rules"] != "rule foo { condition: true }" || sent["corpus"] != "goodware" ||
+		timeRange["start"] != float64(start.Unix()) || timeRange["end"] != nil {
+		t.Errorf("unexpected job attributes: %v", sent)
+	}
+
+	job, err = cli.WaitForRetrohunt(context.Background(), "job", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := job.GetAttributeString("status"); status != "finished" || polls != 3 {
+		t.Errorf("got status %q after %d polls", status, polls)
+	}
+
+	it, err := cli.RetrohuntMatches("job", WithLimit(25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := it.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, ids(objs), 0, 25)
+}
@@ -0,0 +1,108 @@
+package vt
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// writeResponse writes v as a gzipped JSON response, the same way the
+// VirusTotal API does.
+func writeResponse(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(status)
+	gw := gzip.NewWriter(w)
+	json.NewEncoder(gw).Encode(v)
+	gw.Close()
+}
+
+// writeError writes an API error response with the given status and code.
+func writeError(w http.ResponseWriter, status int, code string) {
+	writeResponse(w, status, map[string]interface{}{
+		"error": map[string]string{"code": code, "message": code}})
+}
+
+// newTestClient starts a TLS server that handles requests with h and returns
+// a client that sends its requests to that server, including those addressed
+// to URLs created with URL.
+func newTestClient(t *testing.T, h http.HandlerFunc, options ...ClientOption) *Client {
+	ts := httptest.NewTLSServer(h)
+	t.Cleanup(ts.Close)
+	host := baseURL.Host
+	SetHost(ts.Listener.Addr().String())
+	t.Cleanup(func() { SetHost(host) })
+	options = append([]ClientOption{WithHTTPClient(ts.Client())}, options...)
+	return NewClient("apikey", options...)
+}
+
+// testObjects returns n objects of type "file" with IDs "0" to "n-1".
+func testObjects(n int) []map[string]interface{} {
+	objs := make([]map[string]interface{}, n)
+	for i := range objs {
+		objs[i] = map[string]interface{}{
+			"type":       "file",
+			"id":         strconv.Itoa(i),
+			"attributes": map[string]interface{}{"size": i},
+		}
+	}
+	return objs
+}
+
+// collectionHandler returns a handler that serves objs as a collection in
+// pages of pageSize objects, unless the request specifies a different "limit".
+// Pages are selected with the "cursor" parameter, which is the offset of the
+// first object in the page.
+func collectionHandler(objs []map[string]interface{}, pageSize int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		offset, _ := strconv.Atoi(q.Get("cursor"))
+		size := pageSize
+		if l, err := strconv.Atoi(q.Get("limit")); err == nil {
+			size = l
+		}
+		end := offset + size
+		if end > len(objs) {
+			end = len(objs)
+		}
+		self := url.URL{Scheme: "https", Host: r.Host, Path: r.URL.Path, RawQuery: q.Encode()}
+		links := map[string]string{"self": self.String()}
+		if end < len(objs) {
+			q.Set("cursor", strconv.Itoa(end))
+			next := self
+			next.RawQuery = q.Encode()
+			links["next"] = next.String()
+		}
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data":  objs[offset:end],
+			"links": links,
+			"meta":  map[string]interface{}{"count": len(objs)},
+		})
+	}
+}
+
+// ids returns the IDs of the given objects.
+func ids(objs []*Object) []string {
+	s := make([]string, len(objs))
+	for i, obj := range objs {
+		s[i] = obj.ID
+	}
+	return s
+}
+
+func expectIDs(t *testing.T, got []string, from, to int) {
+	t.Helper()
+	if len(got) != to-from {
+		t.Fatalf("got %d objects, expecting %d: %v", len(got), to-from, got)
+	}
+	for i, id := range got {
+		if id != strconv.Itoa(from+i) {
+			t.Fatalf("object %d has ID %q, expecting %q", i, id, fmt.Sprint(from+i))
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import (
+	"context"
+	"sync"
+)
+
+// flightGroup collapses concurrent calls with the same key into a single one,
+// whose result is shared by all the callers. It's similar to the singleflight
+// package from golang.org/x/sync, which is not used for keeping this package
+// free of dependencies.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall is a call in progress, done is closed once resp and err are set.
+// waiters is the number of callers waiting for the call, which is cancelled
+// when all of them stop waiting.
+type flightCall struct {
+	done    chan struct{}
+	resp    *Response
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// do calls fn and returns its result, unless there's already a call in
+// progress for the same key, in which case it waits for that call to finish
+// and returns the same result. The call doesn't use the context of the caller
+// that started it, but one that keeps its values and is cancelled only when
+// every caller waiting for the call has stopped waiting because its own
+// context was cancelled. Every caller receives its own copy of the response.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (*Response, error)) (*Response, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go func() {
+			defer cancel()
+			c.resp, c.err = fn(callCtx)
+			g.mu.Lock()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// Nobody is waiting for the call anymore, abort it and let new
+			// callers start another one.
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+	if c.resp == nil {
+		return nil, c.err
+	}
+	resp := *c.resp
+	return &resp, c.err
+}
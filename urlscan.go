@@ -15,8 +15,13 @@ package vt
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"mime/multipart"
+	"net/url"
+	"strings"
 )
 
 // URLScanner represents a URL scanner.
@@ -42,15 +47,9 @@ func (s *URLScanner) Scan(url string) (*Object, error) {
 
 	w.Close()
 
-	headers := map[string]string{"Content-Type": w.FormDataContentType()}
+	o := opts(WithHeader("Content-Type", w.FormDataContentType()))
 
-	httpResp, err := s.cli.sendRequest("POST", URL("urls"), &b, headers)
-	if err != nil {
-		return nil, err
-	}
-	defer httpResp.Body.Close()
-
-	apiResp, err := s.cli.parseResponse(httpResp)
+	apiResp, err := s.cli.doRequest(context.Background(), "POST", s.cli.scanURL("urls"), &b, o)
 	if err != nil {
 		return nil, err
 	}
@@ -62,3 +61,25 @@ func (s *URLScanner) Scan(url string) (*Object, error) {
 
 	return analysis, nil
 }
+
+// ScanURL sends a URL to VirusTotal for scanning and returns the analysis
+// object, which can be used for tracking the analysis. The target URL can
+// omit the scheme, in which case http is assumed by VirusTotal. An error is
+// returned without sending the request if target is not a valid URL.
+func (cli *Client) ScanURL(target string) (*Object, error) {
+	u := target
+	if !strings.Contains(u, "://") {
+		u = "http://" + u
+	}
+	if parsed, err := url.Parse(u); err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q", target)
+	}
+	return cli.NewURLScanner().Scan(target)
+}
+
+// URLID returns the identifier that VirusTotal uses for the given URL, which
+// is its unpadded URL-safe base64 encoding. The URL object can be obtained
+// with a GET request to /urls/{id}.
+func URLID(url string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(url))
+}
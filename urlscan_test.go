@@ -0,0 +1,44 @@
+package vt
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestScanURL(t *testing.T) {
+	var submitted string
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v3/urls" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		}
+		submitted = r.FormValue("url")
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"data": map[string]string{"type": "analysis", "id": "analysis-id"}})
+	})
+	obj, err := cli.ScanURL("https://example.com/foo?bar=baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Type != "analysis" || obj.ID != "analysis-id" {
+		t.Errorf("got object %s/%s, expecting analysis", obj.Type, obj.ID)
+	}
+	if submitted != "https://example.com/foo?bar=baz" {
+		t.Errorf("submitted URL %q", submitted)
+	}
+
+	submitted = ""
+	for _, invalid := range []string{"", "http://", "http://exa mple.com"} {
+		if _, err := cli.ScanURL(invalid); err == nil {
+			t.Errorf("expecting error for URL %q", invalid)
+		}
+	}
+	if submitted != "" {
+		t.Errorf("invalid URL %q was submitted", submitted)
+	}
+}
+
+func TestURLID(t *testing.T) {
+	if id := URLID("http://www.virustotal.com/"); id != "aHR0cDovL3d3dy52aXJ1c3RvdGFsLmNvbS8" {
+		t.Errorf("got URL ID %s", id)
+	}
+}
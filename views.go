@@ -0,0 +1,191 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import (
+	"fmt"
+	"time"
+)
+
+// File contains the most commonly used attributes of a file object, as
+// returned by Object.AsFile. Attributes missing from the object have their
+// zero value.
+type File struct {
+	SHA256          string
+	SHA1            string
+	MD5             string
+	Size            int64
+	TypeDescription string
+	Names           []string
+	Tags            []string
+	Reputation      int
+	FirstSubmission time.Time
+	LastSubmission  time.Time
+	LastAnalysis    time.Time
+}
+
+// Domain contains the most commonly used attributes of a domain object, as
+// returned by Object.AsDomain. Attributes missing from the object have their
+// zero value.
+type Domain struct {
+	Name         string
+	Registrar    string
+	Tags         []string
+	Categories   map[string]string
+	Reputation   int
+	CreationDate time.Time
+	LastAnalysis time.Time
+}
+
+// IPAddress contains the most commonly used attributes of an IP address
+// object, as returned by Object.AsIPAddress. Attributes missing from the
+// object have their zero value.
+type IPAddress struct {
+	IP           string
+	Network      string
+	Country      string
+	ASN          int64
+	ASOwner      string
+	Tags         []string
+	Reputation   int
+	LastAnalysis time.Time
+}
+
+// URLObject contains the most commonly used attributes of a URL object, as
+// returned by Object.AsURL. Attributes missing from the object have their
+// zero value.
+type URLObject struct {
+	ID              string
+	URL             string
+	FinalURL        string
+	Title           string
+	Tags            []string
+	Reputation      int
+	FirstSubmission time.Time
+	LastAnalysis    time.Time
+}
+
+// AsFile returns a snapshot of the attributes of a file object. Changes to the
+// returned File are not reflected in the object and vice versa. It returns an
+// error if the object is not a file.
+func (obj *Object) AsFile() (*File, error) {
+	if err := obj.checkType("file"); err != nil {
+		return nil, err
+	}
+	f := &File{}
+	f.SHA256, _ = obj.GetAttributeString("sha256")
+	f.SHA1, _ = obj.GetAttributeString("sha1")
+	f.MD5, _ = obj.GetAttributeString("md5")
+	f.Size, _ = obj.GetAttributeInt64("size")
+	f.TypeDescription, _ = obj.GetAttributeString("type_description")
+	f.Names = obj.stringsAttribute("names")
+	f.Tags = obj.stringsAttribute("tags")
+	f.Reputation, _ = obj.Reputation()
+	f.FirstSubmission = obj.timeAttribute("first_submission_date")
+	f.LastSubmission = obj.timeAttribute("last_submission_date")
+	f.LastAnalysis = obj.timeAttribute("last_analysis_date")
+	return f, nil
+}
+
+// AsDomain returns a snapshot of the attributes of a domain object. Changes
+// to the returned Domain are not reflected in the object and vice versa. It
+// returns an error if the object is not a domain.
+func (obj *Object) AsDomain() (*Domain, error) {
+	if err := obj.checkType("domain"); err != nil {
+		return nil, err
+	}
+	d := &Domain{Name: obj.ID}
+	d.Registrar, _ = obj.GetAttributeString("registrar")
+	d.Tags = obj.stringsAttribute("tags")
+	if categories, ok := obj.Attributes["categories"].(map[string]interface{}); ok {
+		d.Categories = make(map[string]string, len(categories))
+		for engine, category := range categories {
+			d.Categories[engine], _ = category.(string)
+		}
+	}
+	d.Reputation, _ = obj.Reputation()
+	d.CreationDate = obj.timeAttribute("creation_date")
+	d.LastAnalysis = obj.timeAttribute("last_analysis_date")
+	return d, nil
+}
+
+// AsIPAddress returns a snapshot of the attributes of an IP address object.
+// Changes to the returned IPAddress are not reflected in the object and
+// vice versa. It returns an error if the object is not an IP address.
+func (obj *Object) AsIPAddress() (*IPAddress, error) {
+	if err := obj.checkType("ip_address"); err != nil {
+		return nil, err
+	}
+	ip := &IPAddress{IP: obj.ID}
+	ip.Network, _ = obj.GetAttributeString("network")
+	ip.Country, _ = obj.GetAttributeString("country")
+	ip.ASN, _ = obj.GetAttributeInt64("asn")
+	ip.ASOwner, _ = obj.GetAttributeString("as_owner")
+	ip.Tags = obj.stringsAttribute("tags")
+	ip.Reputation, _ = obj.Reputation()
+	ip.LastAnalysis = obj.timeAttribute("last_analysis_date")
+	return ip, nil
+}
+
+// AsURL returns a snapshot of the attributes of a URL object. Changes to the
+// returned URLObject are not reflected in the object and vice versa. It returns
+// an error if the object is not a URL.
+func (obj *Object) AsURL() (*URLObject, error) {
+	if err := obj.checkType("url"); err != nil {
+		return nil, err
+	}
+	u := &URLObject{ID: obj.ID}
+	u.URL, _ = obj.GetAttributeString("url")
+	u.FinalURL, _ = obj.GetAttributeString("last_final_url")
+	u.Title, _ = obj.GetAttributeString("title")
+	u.Tags = obj.stringsAttribute("tags")
+	u.Reputation, _ = obj.Reputation()
+	u.FirstSubmission = obj.timeAttribute("first_submission_date")
+	u.LastAnalysis = obj.timeAttribute("last_analysis_date")
+	return u, nil
+}
+
+// checkType returns an error if the object is not of the given type.
+func (obj *Object) checkType(objType string) error {
+	if obj.Type != objType {
+		return fmt.Errorf("object %s is of type %s, expecting %s", obj.ID, obj.Type, objType)
+	}
+	return nil
+}
+
+// stringsAttribute returns the strings contained in a list attribute, or nil
+// if the attribute doesn't exist or is not a list.
+func (obj *Object) stringsAttribute(name string) []string {
+	list, ok := obj.Attributes[name].([]interface{})
+	if !ok {
+		return nil
+	}
+	s := make([]string, 0, len(list))
+	for _, v := range list {
+		if str, ok := v.(string); ok {
+			s = append(s, str)
+		}
+	}
+	return s
+}
+
+// timeAttribute returns an attribute as a time, or the zero time if the
+// attribute doesn't exist or is not a number.
+func (obj *Object) timeAttribute(name string) time.Time {
+	t, err := obj.GetAttributeTime(name)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
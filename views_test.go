@@ -0,0 +1,118 @@
+package vt
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// loadObject returns the object in the given file of the testdata directory.
+func loadObject(t *testing.T, name string) *Object {
+	t.Helper()
+	b, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := &Object{}
+	if err := json.Unmarshal(b, obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func TestObjectAsFile(t *testing.T) {
+	f, err := loadObject(t, "file.json").AsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &File{
+		SHA256:          "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f",
+		SHA1:            "3395856ce81f2b7382dee72602f798b642f14140",
+		MD5:             "44d88612fea8a8f36de82e1278abb02f",
+		Size:            68,
+		TypeDescription: "Text",
+		Names:           []string{"eicar.com", "eicar.com.txt", "eicar_test_file"},
+		Tags:            []string{"text", "attachment", "via-tor", "known-distributor"},
+		Reputation:      -2151,
+		FirstSubmission: time.Unix(1148301722, 0).UTC(),
+		LastSubmission:  time.Unix(1625009843, 0).UTC(),
+	}
+	if !reflect.DeepEqual(f, expected) {
+		t.Errorf("got %+v, expecting %+v", f, expected)
+	}
+	if _, err := loadObject(t, "file.json").AsDomain(); err == nil {
+		t.Error("expecting error for converting a file into a domain")
+	}
+}
+
+func TestObjectAsDomain(t *testing.T) {
+	d, err := loadObject(t, "domain.json").AsDomain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Domain{
+		Name:      "example.com",
+		Registrar: "RESERVED-Internet Assigned Numbers Authority",
+		Tags:      []string{"parked"},
+		Categories: map[string]string{
+			"Forcepoint ThreatSeeker": "information technology",
+			"BitDefender":             "computersandsoftware",
+		},
+		Reputation:   3,
+		CreationDate: time.Unix(808372800, 0).UTC(),
+		LastAnalysis: time.Unix(1625011325, 0).UTC(),
+	}
+	if !reflect.DeepEqual(d, expected) {
+		t.Errorf("got %+v, expecting %+v", d, expected)
+	}
+	if _, err := loadObject(t, "domain.json").AsFile(); err == nil {
+		t.Error("expecting error for converting a domain into a file")
+	}
+}
+
+func TestObjectAsIPAddress(t *testing.T) {
+	ip, err := loadObject(t, "ip_address.json").AsIPAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &IPAddress{
+		IP:           "8.8.8.8",
+		Network:      "8.8.8.0/24",
+		Country:      "US",
+		ASN:          15169,
+		ASOwner:      "GOOGLE",
+		Tags:         []string{},
+		Reputation:   525,
+		LastAnalysis: time.Unix(1625011325, 0).UTC(),
+	}
+	if !reflect.DeepEqual(ip, expected) {
+		t.Errorf("got %+v, expecting %+v", ip, expected)
+	}
+	if _, err := loadObject(t, "ip_address.json").AsURL(); err == nil {
+		t.Error("expecting error for converting an IP address into a URL")
+	}
+}
+
+func TestObjectAsURL(t *testing.T) {
+	u, err := loadObject(t, "url.json").AsURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &URLObject{
+		ID:              "cf4b367e49bf0b22041c6f065f4aa19f3cfe39c8d5abc0617343d1a66c6a26f5",
+		URL:             "http://example.com/",
+		FinalURL:        "https://example.com/",
+		Title:           "Example Domain",
+		Tags:            []string{"redirect"},
+		FirstSubmission: time.Unix(1227025540, 0).UTC(),
+		LastAnalysis:    time.Unix(1625011325, 0).UTC(),
+	}
+	if !reflect.DeepEqual(u, expected) {
+		t.Errorf("got %+v, expecting %+v", u, expected)
+	}
+	if _, err := loadObject(t, "url.json").AsIPAddress(); err == nil {
+		t.Error("expecting error for converting a URL into an IP address")
+	}
+}
@@ -19,13 +19,20 @@ package vt
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"net/url"
+	"time"
 )
 
-const (
-	version = "0.3"
-)
+// Version is the version of this package, which is included in the
+// User-Agent header of every request. It's a variable rather than a constant
+// so that it can be stamped at build time with:
+//
+//	go build -ldflags "-X github.com/VirusTotal/vt-go.Version=<version>"
+var Version = "0.3"
 
 const (
 	payloadMaxSize = 30 * 1024 * 1024 // 30 MB
@@ -47,12 +54,32 @@ type Response struct {
 	Meta  map[string]interface{} `json:"meta"`
 	Links Links                  `json:"links"`
 	Error Error                  `json:"error"`
+	// Attempts is the number of times the request was sent before getting
+	// this response, which is greater than one if the request was retried.
+	Attempts int `json:"-"`
+	// StatusCode and Header are the HTTP status code and headers of the
+	// response, like the X-Request-Id header identifying the request.
+	StatusCode int         `json:"-"`
+	Header     http.Header `json:"-"`
+	// CacheHit is true if the response was taken from the cache set with
+	// WithResponseCache, because the backend replied that it wasn't modified.
+	CacheHit bool `json:"-"`
 }
 
 // Error contains information about an API error.
 type Error struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// HTTPStatus is the HTTP status code of the response that contained the
+	// error.
+	HTTPStatus int `json:"-"`
+	// Elapsed is the time elapsed between sending the request and receiving
+	// the error.
+	Elapsed time.Duration `json:"-"`
+	// RetryAfter is the time that the server asked to wait before sending the
+	// request again, as indicated by the Retry-After header. It's zero if the
+	// response didn't include the header.
+	RetryAfter time.Duration `json:"-"`
 }
 
 // Error implements the error interface.
@@ -60,16 +87,131 @@ func (e Error) Error() string {
 	return e.Message
 }
 
+// AuthError is the error returned when the backend rejects a request with a
+// 401 status because the API key is missing or invalid. These requests are
+// never retried. Err contains the details returned by the backend, which are
+// also accessible with errors.As, as AuthError wraps them.
+type AuthError struct {
+	Err Error
+}
+
+// Error implements the error interface.
+func (e *AuthError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the API error wrapped by e.
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// apiError returns the Error in err's chain, if any.
+func apiError(err error) (Error, bool) {
+	var apiErr Error
+	ok := errors.As(err, &apiErr)
+	return apiErr, ok
+}
+
+// IsNotFound returns true if err is an API error indicating that the
+// requested object or collection doesn't exist.
+func IsNotFound(err error) bool {
+	apiErr, ok := apiError(err)
+	return ok && (apiErr.Code == "NotFoundError" ||
+		apiErr.HTTPStatus == http.StatusNotFound)
+}
+
+// IsAlreadyExists returns true if err is an API error indicating that the
+// object being created already exists, like a vote from a user that already
+// voted.
+func IsAlreadyExists(err error) bool {
+	apiErr, ok := apiError(err)
+	return ok && (apiErr.Code == "AlreadyExistsError" ||
+		apiErr.HTTPStatus == http.StatusConflict)
+}
+
+// IsQuotaExceeded returns true if err is an API error indicating that the
+// request was rejected because the user exceeded some quota or is sending
+// requests too fast.
+func IsQuotaExceeded(err error) bool {
+	apiErr, ok := apiError(err)
+	return ok && (apiErr.Code == "QuotaExceededError" ||
+		apiErr.Code == "TooManyRequestsError" ||
+		apiErr.HTTPStatus == http.StatusTooManyRequests)
+}
+
+// IsAuthError returns true if err is an API error indicating that the API key
+// is missing or invalid, or that the user is not allowed to perform the
+// request.
+func IsAuthError(err error) bool {
+	apiErr, ok := apiError(err)
+	if !ok {
+		return false
+	}
+	switch apiErr.Code {
+	case "AuthenticationRequiredError", "WrongCredentialsError",
+		"UserNotActiveError", "ForbiddenError":
+		return true
+	}
+	return apiErr.HTTPStatus == http.StatusUnauthorized ||
+		apiErr.HTTPStatus == http.StatusForbidden
+}
+
+// IsTransient returns true if err is an error that may not occur if the
+// request is sent again, like a network timeout or a server that is
+// temporarily unavailable.
+func IsTransient(err error) bool {
+	if apiErr, ok := apiError(err); ok {
+		switch apiErr.HTTPStatus {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return apiErr.Code == "TransientError" || apiErr.Code == "DeadlineExceededError"
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
 // URL returns a full VirusTotal API URL from a relative path (i.e: a path
 // without the domain name and the "/api/v3/" prefix). The path can contain
 // format 'verbs' as defined in the "fmt". This function is useful for creating
 // URLs to be passed to any function expecting a *url.URL in this library.
+// Clients using a different base URL rebase these URLs when sending requests,
+// see WithBaseURL.
 func URL(pathFmt string, a ...interface{}) *url.URL {
 	path := fmt.Sprintf(pathFmt, a...)
 	url, _ := url.Parse(path)
 	return baseURL.ResolveReference(url)
 }
 
+// ObjectURL returns the URL of the object with the given ID in a collection,
+// like "files" or "urls". The ID is escaped, so IDs containing characters with
+// a special meaning in URLs, like slashes, are handled correctly. This is
+// the preferred way of building the URLs passed to GetObject and similar
+// functions.
+func ObjectURL(collection, id string) *url.URL {
+	return URL("%s/%s", collection, url.PathEscape(id))
+}
+
+// RelationshipURL returns the URL of the objects related to the object with
+// the given ID in a collection through the given relationship, like the
+// "contacted_domains" of a file. The URL can be passed to Iterator. The ID is
+// escaped, see ObjectURL.
+func RelationshipURL(collection, id, relationship string) *url.URL {
+	return URL("%s/%s/%s", collection, url.PathEscape(id), relationship)
+}
+
+// CommentsURL returns the URL of the comments of the object with the given ID
+// in a collection, see RelationshipURL.
+func CommentsURL(collection, id string) *url.URL {
+	return RelationshipURL(collection, id, "comments")
+}
+
+// VotesURL returns the URL of the votes of the object with the given ID in a
+// collection, see RelationshipURL.
+func VotesURL(collection, id string) *url.URL {
+	return RelationshipURL(collection, id, "votes")
+}
+
 // SetHost allows to change the host used while sending requests to the
 // VirusTotal API. The default host is "www.virustotal.com" you rarely need to
 // change it.
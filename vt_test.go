@@ -16,3 +16,15 @@ func ExampleURL() {
 	// https://www.virustotal.com/api/v3/files/275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f
 	// https://www.virustotal.com/api/v3/intelligence/retrohunt_jobs/1234567
 }
+
+func ExampleObjectURL() {
+	fmt.Println(vt.ObjectURL("files", "275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"))
+	fmt.Println(vt.ObjectURL("comments", "f-275a021b/1+2"))
+	fmt.Println(vt.RelationshipURL("domains", "example.com", "resolutions"))
+	fmt.Println(vt.CommentsURL("urls", "a/b?c"))
+	// Output:
+	// https://www.virustotal.com/api/v3/files/275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f
+	// https://www.virustotal.com/api/v3/comments/f-275a021b%2F1+2
+	// https://www.virustotal.com/api/v3/domains/example.com/resolutions
+	// https://www.virustotal.com/api/v3/urls/a%2Fb%3Fc/comments
+}
@@ -0,0 +1,81 @@
+// Copyright © 2017 The vt-go authors. All Rights Reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// defaultZipPollInterval is the interval used by WaitForZip when none is
+// specified.
+const defaultZipPollInterval = 5 * time.Second
+
+// CreateZip asks the backend to create a ZIP file containing the files with
+// the given hashes (SHA-256, SHA-1 or MD5), and returns the newly created
+// zip_file object. If password is not empty the ZIP file is protected with it.
+// The ZIP file is created asynchronously, use WaitForZip for waiting until
+// it's ready and DownloadZip for downloading it. This requires a VirusTotal
+// Enterprise account.
+func (cli *Client) CreateZip(hashes []string, password string) (*Object, error) {
+	data := map[string]interface{}{"hashes": hashes}
+	if password != "" {
+		data["password"] = password
+	}
+	resp, err := cli.PostData(URL("intelligence/zip_files"), data)
+	if err != nil {
+		return nil, err
+	}
+	obj := &Object{}
+	if err := json.Unmarshal(resp.Data, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// zipFailed returns true if status is the status of a ZIP file whose creation
+// failed, like "failed", "timeout" or "error-creating".
+func zipFailed(status string) bool {
+	return status == "failed" || status == "timeout" || strings.HasPrefix(status, "error")
+}
+
+// WaitForZip polls the ZIP file with the given ID until its status is
+// "finished", and returns the zip_file object. If the creation of the ZIP file
+// fails it returns an error that includes the status reported by the backend.
+// The ZIP file is requested every interval, or every 5 seconds if interval is
+// zero.
+func (cli *Client) WaitForZip(ctx context.Context, id string, interval time.Duration) (*Object, error) {
+	if interval <= 0 {
+		interval = defaultZipPollInterval
+	}
+	return cli.pollObject(ctx, URL("intelligence/zip_files/%s", id), interval,
+		func(obj *Object) (bool, error) {
+			status, _ := obj.GetAttributeString("status")
+			if zipFailed(status) {
+				return false, fmt.Errorf("creation of zip file %s failed with status %q", id, status)
+			}
+			return status == "finished", nil
+		})
+}
+
+// DownloadZip downloads the ZIP file with the given ID, which must have been
+// created with CreateZip and be finished, and writes it into w. It returns
+// the number of bytes written.
+func (cli *Client) DownloadZip(zipID string, w io.Writer) (int64, error) {
+	return cli.download(context.Background(), URL("intelligence/zip_files/%s/download", zipID), w, nil)
+}
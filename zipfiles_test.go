@@ -0,0 +1,85 @@
+package vt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestZipFiles(t *testing.T) {
+	var sent map[string]interface{}
+	polls := 0
+	zipFile := func(id, status string) map[string]interface{} {
+		return map[string]interface{}{
+			"data": map[string]interface{}{
+				"type": "zip_file", "id": id,
+				"attributes": map[string]interface{}{"status": status}}}
+	}
+	cli := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/v3/intelligence/zip_files":
+			var req struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			sent = req.Data
+			writeResponse(w, http.StatusOK, zipFile("zip", "starting"))
+		case r.URL.Path == "/api/v3/intelligence/zip_files/zip":
+			polls++
+			status := "creating"
+			if polls == 3 {
+				status = "finished"
+			}
+			writeResponse(w, http.StatusOK, zipFile("zip", status))
+		case r.URL.Path == "/api/v3/intelligence/zip_files/broken":
+			writeResponse(w, http.StatusOK, zipFile("broken", "error-creating"))
+		case r.URL.Path == "/api/v3/intelligence/zip_files/zip/download":
+			// The backend redirects to the storage where the file is.
+			http.Redirect(w, r, "/storage/zip", http.StatusFound)
+		case r.URL.Path == "/storage/zip":
+			w.Write([]byte("PK zip content"))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL)
+		}
+	})
+
+	obj, err := cli.CreateZip([]string{"foo", "bar"}, "infected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.ID != "zip" {
+		t.Errorf("got zip file %q", obj.ID)
+	}
+	hashes, _ := sent["hashes"].([]interface{})
+	if len(hashes) != 2 || hashes[0] != "foo" || sent["password"] != "infected" {
+		t.Errorf("sent %v", sent)
+	}
+
+	obj, err = cli.WaitForZip(context.Background(), "zip", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := obj.GetAttributeString("status"); status != "finished" || polls != 3 {
+		t.Errorf("got status %q after %d polls", status, polls)
+	}
+
+	_, err = cli.WaitForZip(context.Background(), "broken", time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "error-creating") {
+		t.Errorf("got error %v for failed zip file", err)
+	}
+
+	var buf bytes.Buffer
+	n, err := cli.DownloadZip("zip", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "PK zip content" || n != int64(buf.Len()) {
+		t.Errorf("downloaded %d bytes: %q", n, buf.String())
+	}
+}